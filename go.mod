@@ -8,6 +8,7 @@ require (
 	github.com/segmentio/encoding v0.5.3
 	github.com/stretchr/testify v1.11.1
 	golang.org/x/sync v0.19.0
+	golang.org/x/text v0.32.0
 )
 
 require (
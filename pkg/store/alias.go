@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// liveIndexTTL is the duration the resolution of the alias is cached for.
+// Clients follow a swap of the alias within this duration.
+const liveIndexTTL = 10 * time.Second
+
+// ErrAliasNotFound is returned when the index alias does not exist yet.
+var ErrAliasNotFound = errors.New("index alias not found")
+
+// liveIndexCache caches the resolution of the index alias.
+type liveIndexCache struct {
+	mu         sync.Mutex
+	name       string
+	index      IndexConfig
+	resolvedAt time.Time
+}
+
+// WithIndex returns a client pinned to an index version: it operates on this
+// index rather than on the one the alias points to. The connection pool is
+// shared with c.
+func (c *Client) WithIndex(index IndexConfig) *Client {
+	return &Client{
+		Client: c.Client,
+		index:  index,
+		pinned: true,
+	}
+}
+
+// WithCollection returns a client operating on the live index of a collection,
+// with the index settings of c. The connection pool is shared with c.
+// The collection name is expected to be valid.
+func (c *Client) WithCollection(collection string) *Client {
+	index := c.index
+	index.Collection = collection
+	return &Client{
+		Client: c.Client,
+		index:  index,
+		pinned: c.pinned,
+		live:   &liveIndexCache{},
+	}
+}
+
+// Resolved returns a client operating on the index the alias points to now,
+// rather than following its later swaps, so that a search or an import uses a
+// single index version along with the vectorizer of its model. Unlike pinned
+// clients, it writes the suggestions. The connection pool is shared with c.
+func (c *Client) Resolved(ctx context.Context) *Client {
+	if c.pinned || c.resolved {
+		return c
+	}
+	_, index := c.liveIndex(ctx)
+	return &Client{
+		Client:   c.Client,
+		index:    index,
+		resolved: true,
+	}
+}
+
+// Config returns the configuration of the index of the client.
+func (c *Client) Config() IndexConfig {
+	return c.index
+}
+
+// LiveIndex returns the configuration of the index the alias points to. The
+// vector field settings and the vectorizer address are read from the index,
+// the other settings are the ones of the client.
+func (c *Client) LiveIndex(ctx context.Context) (IndexConfig, error) {
+	info, err := c.FTInfo(ctx, c.index.Alias()).Result()
+	if err != nil {
+		if isUnknownIndex(err) {
+			return IndexConfig{}, ErrAliasNotFound
+		}
+		return IndexConfig{}, fmt.Errorf("failed to get info of index alias: %w", err)
+	}
+	version, ok := c.index.versionFromName(info.IndexName)
+	if !ok {
+		return IndexConfig{}, fmt.Errorf("alias %s points to the unversioned index %s", c.index.Alias(), info.IndexName)
+	}
+
+	index := c.index
+	index.Version = version
+	for _, attribute := range info.Attributes {
+		if attribute.Attribute != "embedding" {
+			continue
+		}
+		if attribute.Algorithm != "" {
+			index.Algorithm = strings.ToUpper(attribute.Algorithm)
+		}
+		if attribute.DataType != "" {
+			index.VectorType = strings.ToUpper(attribute.DataType)
+		}
+		if attribute.DistanceMetric != "" {
+			index.DistanceMetric = strings.ToUpper(attribute.DistanceMetric)
+		}
+		if attribute.Dim > 0 {
+			index.Dimension = attribute.Dim
+		}
+	}
+	// The address is read from the version the alias pointed to, whatever
+	// swap happened since.
+	addr, err := c.Get(ctx, index.vectorizerKey()).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return IndexConfig{}, fmt.Errorf("failed to get vectorizer of index %s: %w", index.Name(), err)
+	}
+	index.VectorizerAddr = addr
+	return index, nil
+}
+
+// liveIndex returns the name to search and the configuration of the index the
+// client operates on. Unpinned clients operate on the index the alias points
+// to, or on their configured index until the alias is created.
+func (c *Client) liveIndex(ctx context.Context) (string, IndexConfig) {
+	if c.pinned || c.resolved {
+		return c.index.Name(), c.index
+	}
+
+	c.live.mu.Lock()
+	defer c.live.mu.Unlock()
+	if !c.live.resolvedAt.IsZero() && time.Since(c.live.resolvedAt) < liveIndexTTL {
+		return c.live.name, c.live.index
+	}
+
+	index, err := c.LiveIndex(ctx)
+	switch {
+	case errors.Is(err, ErrAliasNotFound):
+		c.live.name, c.live.index = c.index.Name(), c.index
+	case err != nil:
+		// The previous resolution is kept, the next call retries.
+		log.Printf("Failed to resolve index alias: %v", err)
+		if c.live.resolvedAt.IsZero() {
+			return c.index.Name(), c.index
+		}
+		return c.live.name, c.live.index
+	default:
+		c.live.name, c.live.index = c.index.Alias(), index
+	}
+	c.live.resolvedAt = time.Now()
+	return c.live.name, c.live.index
+}
+
+// isUnknownIndex reports whether err is the error of a missing index or alias.
+// Its message depends on the RediSearch version.
+func isUnknownIndex(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unknown index") || strings.Contains(message, "no such index")
+}
+
+// SwapAlias points the alias to the index of the client.
+func (c *Client) SwapAlias(ctx context.Context) error {
+	if err := c.FTAliasUpdate(ctx, c.index.Name(), c.index.Alias()).Err(); err != nil {
+		return fmt.Errorf("failed to point alias %s to index %s: %w", c.index.Alias(), c.index.Name(), err)
+	}
+	log.Printf("Alias %s now points to index %s", c.index.Alias(), c.index.Name())
+	return nil
+}
+
+// SetVectorizer records the address of the vectorizer serving the model of the
+// index of the client. The clients resolving the index through the alias embed
+// their texts with it, so that a swap of the alias switches the model along
+// with the index.
+func (c *Client) SetVectorizer(ctx context.Context, addr string) error {
+	if err := c.Set(ctx, c.index.vectorizerKey(), addr, 0).Err(); err != nil {
+		return fmt.Errorf("failed to set vectorizer of index %s: %w", c.index.Name(), err)
+	}
+	return nil
+}
+
+// DropIndex drops the index of the client and deletes its articles, and
+// returns the number of deleted articles. The suggestions are shared by the
+// index versions and are kept.
+func (c *Client) DropIndex(ctx context.Context) (int, error) {
+	if err := c.FTDropIndex(ctx, c.index.Name()).Err(); err != nil && !isUnknownIndex(err) {
+		return 0, fmt.Errorf("failed to drop index %s: %w", c.index.Name(), err)
+	}
+	if err := c.Del(ctx, c.index.vectorizerKey()).Err(); err != nil {
+		return 0, fmt.Errorf("failed to delete vectorizer of index %s: %w", c.index.Name(), err)
+	}
+
+	// Keys are unlinked by batches rather than with FT.DROPINDEX DD, which
+	// blocks Redis while deleting all the documents.
+	deleted := 0
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, c.index.KeyPrefix()+"*", scanBatchSize).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to scan articles: %w", err)
+		}
+		if len(keys) > 0 {
+			n, err := c.Unlink(ctx, keys...).Result()
+			deleted += int(n)
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete articles: %w", err)
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// ScanArticles calls fn with batches of the articles of the index, including
+// their embedded text. The embeddings are decoded to FLOAT32.
+func (c *Client) ScanArticles(ctx context.Context, fn func([]Article) error) error {
+	_, index := c.liveIndex(ctx)
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, index.KeyPrefix()+"*", scanBatchSize).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan articles: %w", err)
+		}
+
+		pipe := c.Pipeline()
+		cmds := make([]*redis.MapStringStringCmd, 0, len(keys))
+		for _, key := range keys {
+			cmds = append(cmds, pipe.HGetAll(ctx, key))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to get articles: %w", err)
+		}
+
+		articles := make([]Article, 0, len(cmds))
+		for _, cmd := range cmds {
+			// Keys deleted since the scan have no fields.
+			if fields := cmd.Val(); len(fields) > 0 {
+				article, err := index.parseArticle(fields)
+				if err != nil {
+					return err
+				}
+				articles = append(articles, *article)
+			}
+		}
+		if len(articles) > 0 {
+			if err := fn(articles); err != nil {
+				return err
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// ExistingArticles returns the update times of the given articles which are
+// stored, zero for the articles stored before their update time was kept.
+func (c *Client) ExistingArticles(ctx context.Context, ids []string) (map[string]time.Time, error) {
+	_, index := c.liveIndex(ctx)
+	pipe := c.Pipeline()
+	cmds := make([]*redis.SliceCmd, 0, len(ids))
+	for _, id := range ids {
+		cmds = append(cmds, pipe.HMGet(ctx, index.articleKey(id), "title", "updated_at"))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to check existing articles: %w", err)
+	}
+
+	existing := make(map[string]time.Time, len(ids))
+	for i, cmd := range cmds {
+		// Missing keys reply nil fields, and every article has a title.
+		values := cmd.Val()
+		if len(values) < 2 || values[0] == nil {
+			continue
+		}
+		updatedAt, _ := values[1].(string)
+		existing[ids[i]] = parseMilliTimestamp(updatedAt)
+	}
+	return existing, nil
+}
+
+// ServerTime returns the time of the Redis clock, which the update times of
+// the articles are taken from.
+func (c *Client) ServerTime(ctx context.Context) (time.Time, error) {
+	now, err := c.Time(ctx).Result()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get server time: %w", err)
+	}
+	return now, nil
+}
@@ -2,13 +2,22 @@ package store
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/redis/go-redis/v9"
 )
 
 const (
+	// IndexName and ArticlePrefix are the index name and key prefix of the
+	// first index version of the default collection, see IndexConfig.Name and
+	// IndexConfig.KeyPrefix.
 	IndexName     = "gs_data"
 	ArticlePrefix = "article:"
 )
@@ -16,11 +25,19 @@ const (
 // Client wraps a client enabling interactions with the store.
 type Client struct {
 	*redis.Client
-	embeddingDimension int
+	index IndexConfig
+	// pinned clients operate on their configured index rather than on the
+	// index the alias points to.
+	pinned bool
+	// resolved clients operate on the index version the alias pointed to when
+	// they were created, and write the suggestions as unpinned clients do.
+	resolved bool
+	live     *liveIndexCache
 }
 
 // New creates a new Redis client with the appropriate configuration.
-func New(addr, password string, embeddingDimension int) *Client {
+// The index configuration is expected to be valid.
+func New(addr, password string, index IndexConfig) *Client {
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     addr,
 		Password: password,
@@ -29,8 +46,9 @@ func New(addr, password string, embeddingDimension int) *Client {
 	})
 
 	return &Client{
-		Client:             redisClient,
-		embeddingDimension: embeddingDimension,
+		Client: redisClient,
+		index:  index,
+		live:   &liveIndexCache{},
 	}
 }
 
@@ -40,23 +58,50 @@ func (c *Client) Ping(ctx context.Context) error {
 }
 
 // CreateVectorIndex creates the Redis vector search index if it doesn't exist.
+// Unpinned clients create the configured index and point the alias to it,
+// unless the alias already exists: the index is then managed by reindexing.
 func (c *Client) CreateVectorIndex(ctx context.Context) error {
-	result := c.FTCreate(ctx, IndexName, &redis.FTCreateOptions{
+	if !c.pinned {
+		live, err := c.LiveIndex(ctx)
+		switch {
+		case err == nil:
+			if live.Version != c.index.Version {
+				log.Printf("Configured index version %d differs from the live version %d, the live index is used", c.index.Version, live.Version)
+			}
+			return c.addMissingFields(ctx, live.Name())
+		case !errors.Is(err, ErrAliasNotFound):
+			return err
+		}
+	}
+
+	if err := c.createIndex(ctx); err != nil {
+		return err
+	}
+	if c.pinned {
+		return nil
+	}
+	// Another importer may have added the alias concurrently.
+	err := c.FTAliasAdd(ctx, c.index.Name(), c.index.Alias()).Err()
+	if err != nil && !strings.Contains(err.Error(), "Alias already exists") {
+		return fmt.Errorf("failed to add alias %s to index %s: %w", c.index.Alias(), c.index.Name(), err)
+	}
+	return nil
+}
+
+// createIndex creates the configured index, or adds its missing fields when it
+// already exists.
+func (c *Client) createIndex(ctx context.Context) error {
+	name := c.index.Name()
+	result := c.FTCreate(ctx, name, &redis.FTCreateOptions{
 		OnHash: true,
 		Prefix: []interface{}{
-			ArticlePrefix,
+			c.index.KeyPrefix(),
 		},
 	},
 		&redis.FieldSchema{
-			FieldName: "embedding",
-			FieldType: redis.SearchFieldTypeVector,
-			VectorArgs: &redis.FTVectorArgs{
-				FlatOptions: &redis.FTFlatOptions{
-					Type:           "FLOAT32",
-					Dim:            c.embeddingDimension,
-					DistanceMetric: "COSINE",
-				},
-			},
+			FieldName:  "embedding",
+			FieldType:  redis.SearchFieldTypeVector,
+			VectorArgs: c.vectorArgs(),
 		},
 		&redis.FieldSchema{
 			FieldName: "title",
@@ -66,40 +111,177 @@ func (c *Client) CreateVectorIndex(ctx context.Context) error {
 			FieldName: "link",
 			FieldType: redis.SearchFieldTypeText,
 		},
+		&redis.FieldSchema{
+			FieldName: "site",
+			FieldType: redis.SearchFieldTypeTag,
+		},
+		&redis.FieldSchema{
+			FieldName: "published_at",
+			FieldType: redis.SearchFieldTypeNumeric,
+			Sortable:  true,
+		},
 	)
 
 	if err := result.Err(); err != nil {
 		if err.Error() == "Index already exists" {
-			return nil
+			c.checkVectorField(ctx)
+			return c.addMissingFields(ctx, name)
 		}
 		return fmt.Errorf("failed to create index: %w", err)
 	}
 
-	log.Printf("Successfully created Redis index: %s", IndexName)
+	log.Printf("Successfully created Redis index: %s", name)
+	return nil
+}
+
+// vectorArgs returns the definition of the embedding field from the index configuration.
+func (c *Client) vectorArgs() *redis.FTVectorArgs {
+	if c.index.Algorithm == AlgorithmHNSW {
+		return &redis.FTVectorArgs{
+			HNSWOptions: &redis.FTHNSWOptions{
+				Type:                   c.index.VectorType,
+				Dim:                    c.index.Dimension,
+				DistanceMetric:         c.index.DistanceMetric,
+				MaxEdgesPerNode:        c.index.M,
+				MaxAllowedEdgesPerNode: c.index.EFConstruction,
+				EFRunTime:              c.index.EFRuntime,
+			},
+		}
+	}
+	return &redis.FTVectorArgs{
+		FlatOptions: &redis.FTFlatOptions{
+			Type:           c.index.VectorType,
+			Dim:            c.index.Dimension,
+			DistanceMetric: c.index.DistanceMetric,
+		},
+	}
+}
+
+// checkVectorField warns when the embedding field of an existing index does not
+// match the index configuration. The vector field cannot be altered, the index
+// must be rebuilt for the configuration to apply.
+func (c *Client) checkVectorField(ctx context.Context) {
+	info, err := c.FTInfo(ctx, c.index.Name()).Result()
+	if err != nil {
+		log.Printf("Failed to get index info: %v", err)
+		return
+	}
+	for _, attribute := range info.Attributes {
+		if attribute.Attribute != "embedding" {
+			continue
+		}
+		if !strings.EqualFold(attribute.Algorithm, c.index.Algorithm) ||
+			!strings.EqualFold(attribute.DataType, c.index.VectorType) ||
+			!strings.EqualFold(attribute.DistanceMetric, c.index.DistanceMetric) ||
+			attribute.Dim != c.index.Dimension {
+			log.Printf("Index %s was created with a %s %s %s vector field of dimension %d, the configured %s %s %s of dimension %d requires a reindex",
+				c.index.Name(), attribute.Algorithm, attribute.DataType, attribute.DistanceMetric, attribute.Dim,
+				c.index.Algorithm, c.index.VectorType, c.index.DistanceMetric, c.index.Dimension)
+		}
+	}
+}
+
+// addedFields are the fields added to the index schema after its first
+// release, with their definition.
+var addedFields = [][]interface{}{
+	{"site", "TAG"},
+	{"published_at", "NUMERIC", "SORTABLE"},
+}
+
+// addMissingFields adds the fields missing from an index created before their introduction.
+func (c *Client) addMissingFields(ctx context.Context, name string) error {
+	for _, field := range addedFields {
+		err := c.FTAlter(ctx, name, false, field).Err()
+		if err != nil && !strings.Contains(err.Error(), "Duplicate field") {
+			return fmt.Errorf("failed to add field %s to index: %w", field[0], err)
+		}
+	}
 	return nil
 }
 
 // Article is the model for a stored article.
 type Article struct {
-	Title     string
-	Link      string
+	Title       string
+	Link        string
+	Site        string
+	PublishedAt time.Time
+	// Text is the text the embedding was generated from. It is kept to
+	// generate the embeddings of a new index version.
+	Text      string
 	Embedding []byte
+	// UpdatedAt is the time the article was last stored, by the clock of
+	// Redis. It is set when zero, and kept when the article is copied to a
+	// new index version.
+	UpdatedAt time.Time
+}
+
+// SiteFromURL returns the site an URL belongs to, that is its host without
+// the "www." prefix.
+func SiteFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(u.Hostname(), "www.")
 }
 
 // StoreArticles stores multiple articles with their embeddings in Redis using a pipeline.
+// The titles of articles stored for the first time are added to the suggestion dictionary,
+// unless the client is pinned: the dictionary is shared by the index versions.
 func (c *Client) StoreArticles(ctx context.Context, articles []Article) error {
 	if len(articles) == 0 {
 		return nil
 	}
+	_, index := c.liveIndex(ctx)
 
-	pipe := c.Pipeline()
+	existsPipe := c.Pipeline()
+	existsCmds := make([]*redis.IntCmd, 0, len(articles))
 	for _, article := range articles {
-		key := fmt.Sprintf("%s%s", ArticlePrefix, article.Title)
-		pipe.HSet(ctx, key, map[string]interface{}{
-			"title":     article.Title,
-			"link":      article.Link,
-			"embedding": article.Embedding,
-		})
+		existsCmds = append(existsCmds, existsPipe.Exists(ctx, index.articleKey(article.Title)))
+	}
+	epochCmd := existsPipe.Get(ctx, suggestionEpochKey(index.suggestionDictionary()))
+	timeCmd := existsPipe.Time(ctx)
+	// A missing epoch is read from its command.
+	if _, err := existsPipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to check existing articles: %w", err)
+	}
+	epoch, err := parseSuggestionEpoch(epochCmd)
+	if err != nil {
+		return err
+	}
+
+	pipe := c.Pipeline()
+	for i, article := range articles {
+		embedding, err := index.encodeVector(article.Embedding)
+		if err != nil {
+			return fmt.Errorf("failed to encode embedding of article %s: %w", article.Title, err)
+		}
+		updatedAt := article.UpdatedAt
+		if updatedAt.IsZero() {
+			updatedAt = timeCmd.Val()
+		}
+		fields := map[string]interface{}{
+			"title":      article.Title,
+			"link":       article.Link,
+			"site":       article.Site,
+			"embedding":  embedding,
+			"updated_at": updatedAt.UnixMilli(),
+		}
+		if !article.PublishedAt.IsZero() {
+			fields["published_at"] = article.PublishedAt.Unix()
+		}
+		if article.Text != "" {
+			fields["text"] = article.Text
+		}
+		pipe.HSet(ctx, index.articleKey(article.Title), fields)
+
+		if existsCmds[i].Val() == 0 && !c.pinned {
+			publishedAt := article.PublishedAt
+			if publishedAt.IsZero() {
+				publishedAt = time.Now()
+			}
+			pipe.Do(ctx, addSuggestionArgs(index.suggestionDictionary(), article.Title, article.Link, recencyBoost(epoch, publishedAt))...)
+		}
 	}
 
 	if _, err := pipe.Exec(ctx); err != nil {
@@ -109,39 +291,358 @@ func (c *Client) StoreArticles(ctx context.Context, articles []Article) error {
 	return nil
 }
 
+// GetArticle returns a stored article.
+func (c *Client) GetArticle(ctx context.Context, id string) (*Article, error) {
+	_, index := c.liveIndex(ctx)
+	fields, err := c.HGetAll(ctx, index.articleKey(id)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get article: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrArticleNotFound
+	}
+	return index.parseArticle(fields)
+}
+
+// parseArticle parses the fields of the hash storing an article.
+func (c IndexConfig) parseArticle(fields map[string]string) (*Article, error) {
+	embedding, err := c.decodeVector([]byte(fields["embedding"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode embedding of article %s: %w", fields["title"], err)
+	}
+
+	return &Article{
+		Title:       fields["title"],
+		Link:        fields["link"],
+		Site:        fields["site"],
+		PublishedAt: parseTimestamp(fields["published_at"]),
+		Text:        fields["text"],
+		Embedding:   embedding,
+		UpdatedAt:   parseMilliTimestamp(fields["updated_at"]),
+	}, nil
+}
+
+// ArticleRef identifies a stored article.
+type ArticleRef struct {
+	ID          string
+	Link        string
+	PublishedAt time.Time
+}
+
+// scanBatchSize is the number of keys requested per SCAN iteration.
+const scanBatchSize = 1000
+
+// ListSiteArticles returns the references of all the stored articles of a site.
+// Keys are scanned rather than searched, as search results are capped by Redis.
+func (c *Client) ListSiteArticles(ctx context.Context, site string) ([]ArticleRef, error) {
+	_, index := c.liveIndex(ctx)
+	var refs []ArticleRef
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, index.KeyPrefix()+"*", scanBatchSize).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan articles: %w", err)
+		}
+
+		pipe := c.Pipeline()
+		cmds := make([]*redis.SliceCmd, 0, len(keys))
+		for _, key := range keys {
+			cmds = append(cmds, pipe.HMGet(ctx, key, "site", "link", "published_at"))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get articles: %w", err)
+		}
+		for i, cmd := range cmds {
+			values := cmd.Val()
+			articleSite, _ := values[0].(string)
+			if articleSite != site {
+				continue
+			}
+			link, _ := values[1].(string)
+			publishedAt, _ := values[2].(string)
+			refs = append(refs, ArticleRef{
+				ID:          index.articleID(keys[i]),
+				Link:        link,
+				PublishedAt: parseTimestamp(publishedAt),
+			})
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return refs, nil
+		}
+	}
+}
+
+// DeleteArticle deletes a stored article, and its title from the suggestion dictionary.
+func (c *Client) DeleteArticle(ctx context.Context, id string) error {
+	deleted, err := c.DeleteArticles(ctx, []string{id})
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrArticleNotFound
+	}
+	return nil
+}
+
+// deleteBatchSize is the number of articles deleted at once when deleting a site.
+const deleteBatchSize = 1000
+
+// DeleteSiteArticles deletes all the articles of a site, and returns the
+// number of deleted articles. It fails when a batch of indexed articles cannot
+// be deleted, rather than searching them again.
+func (c *Client) DeleteSiteArticles(ctx context.Context, site string) (int, error) {
+	name, index := c.liveIndex(ctx)
+	total := 0
+	for {
+		// Deleted articles leave the index, the next batch is always the first page.
+		result, err := c.FTSearchWithArgs(ctx, name, SearchOptions{Site: site}.filterQuery(), &redis.FTSearchOptions{
+			NoContent:      true,
+			DialectVersion: 2,
+			Limit:          deleteBatchSize,
+		}).Result()
+		if err != nil {
+			return total, fmt.Errorf("failed to list articles of site %s: %w", site, err)
+		}
+		if len(result.Docs) == 0 {
+			return total, nil
+		}
+
+		ids := make([]string, 0, len(result.Docs))
+		for _, doc := range result.Docs {
+			ids = append(ids, index.articleID(doc.ID))
+		}
+		deleted, err := c.DeleteArticles(ctx, ids)
+		total += deleted
+		if err != nil {
+			return total, err
+		}
+		if deleted == 0 {
+			// The indexed articles could not be deleted, such as keys which are
+			// not articles of the index: searching again would return them.
+			return total, fmt.Errorf("failed to delete %d indexed articles of site %s", len(ids), site)
+		}
+	}
+}
+
+// DeleteArticles deletes articles and their suggestions, and returns the
+// number of deleted articles. Pinned clients leave the suggestions, shared by
+// the index versions, unchanged.
+func (c *Client) DeleteArticles(ctx context.Context, ids []string) (int, error) {
+	_, index := c.liveIndex(ctx)
+	pipe := c.Pipeline()
+	delCmds := make([]*redis.IntCmd, 0, len(ids))
+	for _, id := range ids {
+		delCmds = append(delCmds, pipe.Del(ctx, index.articleKey(id)))
+		if !c.pinned {
+			pipe.Do(ctx, "FT.SUGDEL", index.suggestionDictionary(), id)
+		}
+	}
+	// FT.SUGDEL replies 0 for titles missing from the dictionary, which is not an error.
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to delete articles: %w", err)
+	}
+
+	deleted := 0
+	for _, cmd := range delCmds {
+		deleted += int(cmd.Val())
+	}
+	return deleted, nil
+}
+
 // SearchHit represents an article search result, from Redis.
 type SearchHit struct {
-	Title string
-	Link  string
+	ID          string
+	Title       string
+	Link        string
+	Site        string
+	PublishedAt time.Time
+	// Score is the similarity of the article to the query, from 0 to 1,
+	// higher meaning more similar.
 	Score float64
+	// Distance is the raw distance of the index metric, lower meaning more
+	// similar.
+	Distance float64
+	// Text is the embedded text of the article, empty for the articles
+	// stored without it.
+	Text string
+	// Embedding is the FLOAT32 embedding of the article, when requested.
+	Embedding []byte
+}
+
+// SearchOptions holds the optional filters of a search.
+type SearchOptions struct {
+	// Site restricts the search to the articles of a site.
+	Site string
+	// PublishedAfter and PublishedBefore restrict the search to the articles
+	// published in the time range, when set.
+	PublishedAfter  time.Time
+	PublishedBefore time.Time
+	// Offset is the number of nearest neighbours to skip in the results.
+	Offset int
+	// EFRuntime overrides the HNSW EF_RUNTIME of the index configuration when
+	// positive. It is ignored by FLAT indexes.
+	EFRuntime int
+	// MinScore drops the nearest neighbours with a lower similarity to the
+	// query, when positive.
+	MinScore float64
+	// WithEmbeddings returns the embeddings of the articles in the hits.
+	WithEmbeddings bool
+}
+
+// filterQuery builds the pre-filter of a KNN query from the search options.
+func (o SearchOptions) filterQuery() string {
+	var filters []string
+	if o.Site != "" {
+		filters = append(filters, fmt.Sprintf("@site:{%s}", escapeTag(o.Site)))
+	}
+	if !o.PublishedAfter.IsZero() || !o.PublishedBefore.IsZero() {
+		from, to := "-inf", "+inf"
+		if !o.PublishedAfter.IsZero() {
+			from = strconv.FormatInt(o.PublishedAfter.Unix(), 10)
+		}
+		if !o.PublishedBefore.IsZero() {
+			to = strconv.FormatInt(o.PublishedBefore.Unix(), 10)
+		}
+		filters = append(filters, fmt.Sprintf("@published_at:[%s %s]", from, to))
+	}
+	if len(filters) == 0 {
+		return "*"
+	}
+	return strings.Join(filters, " ")
+}
+
+// tagSpecialChars are the characters to escape in TAG query values.
+const tagSpecialChars = `,.<>{}[]"':;!@#$%^&*()-+=~|/\ `
+
+// escapeTag escapes the punctuation and spaces of a TAG value.
+func escapeTag(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if strings.ContainsRune(tagSpecialChars, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
 
 // VectorSearch performs a search on the store to retrieve articles.
-// The search is a KNN search based on the provided query embedding.
-func (c *Client) VectorSearch(ctx context.Context, queryEmbedding []byte, k int) ([]SearchHit, error) {
-	// KNN query with score alias for sorting
-	knnQuery := fmt.Sprintf("*=>[KNN %d @embedding $query_vec AS vector_score]", k)
-
-	searchCmd := c.FTSearchWithArgs(
-		ctx,
-		IndexName,
-		knnQuery,
-		&redis.FTSearchOptions{
-			SortBy: []redis.FTSearchSortBy{
-				{FieldName: "vector_score", Asc: true},
-			},
-			DialectVersion: 2,
-			Params: map[string]interface{}{
-				"query_vec": queryEmbedding,
-			},
-			Return: []redis.FTSearchReturn{
-				{FieldName: "title"},
-				{FieldName: "link"},
-				{FieldName: "vector_score"},
-			},
+// The search is a KNN search based on the provided FLOAT32 query embedding, the
+// k nearest neighbours are returned, minus the first opts.Offset ones.
+// The query embedding must have the dimension of the index, ErrDimensionMismatch
+// is returned otherwise.
+func (c *Client) VectorSearch(ctx context.Context, queryEmbedding []byte, k int, opts SearchOptions) ([]SearchHit, error) {
+	name, index := c.liveIndex(ctx)
+	vector, err := index.queryVector(queryEmbedding)
+	if err != nil {
+		return nil, err
+	}
+	return c.knnSearch(ctx, name, index, vector, k, opts)
+}
+
+// ErrDimensionMismatch is returned when a query embedding does not have the
+// dimension of the index.
+var ErrDimensionMismatch = errors.New("embedding dimension mismatch")
+
+// VectorQuery is a vector search of a batch.
+type VectorQuery struct {
+	// Embedding is the FLOAT32 query embedding.
+	Embedding []byte
+	K         int
+	Opts      SearchOptions
+}
+
+// VectorSearchResult is the result of a vector search of a batch.
+type VectorSearchResult struct {
+	Hits []SearchHit
+	Err  error
+}
+
+// VectorSearchBatch performs the vector searches of a batch in a single
+// pipeline, as VectorSearch does. The results are in the order of the
+// queries, each with its own error.
+func (c *Client) VectorSearchBatch(ctx context.Context, queries []VectorQuery) []VectorSearchResult {
+	name, index := c.liveIndex(ctx)
+	results := make([]VectorSearchResult, len(queries))
+	cmds := make([]*redis.FTSearchCmd, len(queries))
+	pipe := c.Pipeline()
+	for i, q := range queries {
+		vector, err := index.queryVector(q.Embedding)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		query, args := knnSearchArgs(index, vector, q.K, q.Opts)
+		cmds[i] = pipe.FTSearchWithArgs(ctx, name, query, args)
+	}
+	// The errors are read from each command.
+	_, _ = pipe.Exec(ctx)
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		results[i].Hits, results[i].Err = parseSearchHits(index, queries[i].Opts, cmd)
+	}
+	return results
+}
+
+// knnSearch runs a KNN search on an index with a vector of its vector type.
+func (c *Client) knnSearch(ctx context.Context, name string, index IndexConfig, vector []byte, k int, opts SearchOptions) ([]SearchHit, error) {
+	query, args := knnSearchArgs(index, vector, k, opts)
+	return parseSearchHits(index, opts, c.FTSearchWithArgs(ctx, name, query, args))
+}
+
+// knnSearchArgs builds the query and arguments of a KNN search on an index
+// with a vector of its vector type.
+func knnSearchArgs(index IndexConfig, vector []byte, k int, opts SearchOptions) (string, *redis.FTSearchOptions) {
+	params := map[string]interface{}{
+		"query_vec": vector,
+	}
+	// The configured EF_RUNTIME is passed to every query rather than relying on
+	// the index default, so that it can be tuned without rebuilding the index.
+	knnArgs := ""
+	if index.Algorithm == AlgorithmHNSW {
+		efRuntime := opts.EFRuntime
+		if efRuntime <= 0 {
+			efRuntime = index.EFRuntime
+		}
+		knnArgs = " EF_RUNTIME $ef_runtime"
+		params["ef_runtime"] = efRuntime
+	}
+	// KNN query with score alias for sorting. opts.MinScore is applied to the
+	// nearest neighbours by parseSearchHits: a VECTOR_RANGE query would
+	// gather and sort every article within the radius instead.
+	query := fmt.Sprintf("(%s)=>[KNN %d @embedding $query_vec%s AS vector_score]", opts.filterQuery(), k, knnArgs)
+
+	returnFields := []redis.FTSearchReturn{
+		{FieldName: "title"},
+		{FieldName: "link"},
+		{FieldName: "site"},
+		{FieldName: "published_at"},
+		{FieldName: "text"},
+		{FieldName: "vector_score"},
+	}
+	if opts.WithEmbeddings {
+		returnFields = append(returnFields, redis.FTSearchReturn{FieldName: "embedding"})
+	}
+
+	return query, &redis.FTSearchOptions{
+		SortBy: []redis.FTSearchSortBy{
+			{FieldName: "vector_score", Asc: true},
 		},
-	)
+		DialectVersion: 2,
+		LimitOffset:    opts.Offset,
+		Limit:          k - opts.Offset,
+		Params:         params,
+		Return:         returnFields,
+	}
+}
 
+// parseSearchHits reads the hits of a KNN search command, above opts.MinScore.
+func parseSearchHits(index IndexConfig, opts SearchOptions, searchCmd *redis.FTSearchCmd) ([]SearchHit, error) {
 	if err := searchCmd.Err(); err != nil {
 		return nil, fmt.Errorf("vector search failed: %w", err)
 	}
@@ -153,22 +654,159 @@ func (c *Client) VectorSearch(ctx context.Context, queryEmbedding []byte, k int)
 
 	results := make([]SearchHit, 0, len(searchResult.Docs))
 	for _, doc := range searchResult.Docs {
-		title := doc.Fields["title"]
-		link := doc.Fields["link"]
-
-		score := 0.0
+		distance := 0.0
 		if scoreVal := doc.Fields["vector_score"]; scoreVal != "" {
-			if _, err := fmt.Sscanf(scoreVal, "%f", &score); err != nil {
+			if _, err := fmt.Sscanf(scoreVal, "%f", &distance); err != nil {
 				log.Printf("Error parsing score: %v", err)
 			}
 		}
 
-		results = append(results, SearchHit{
-			Title: title,
-			Link:  link,
-			Score: score,
-		})
+		score := index.Similarity(distance)
+		if score < opts.MinScore {
+			continue
+		}
+		hit, err := newSearchHit(index, opts, doc)
+		if err != nil {
+			return nil, err
+		}
+		hit.Score = score
+		hit.Distance = distance
+		results = append(results, hit)
 	}
 
 	return results, nil
 }
+
+// newSearchHit reads the fields of an article returned by a search, without
+// its score.
+func newSearchHit(index IndexConfig, opts SearchOptions, doc redis.Document) (SearchHit, error) {
+	var embedding []byte
+	if opts.WithEmbeddings {
+		var err error
+		if embedding, err = index.decodeVector([]byte(doc.Fields["embedding"])); err != nil {
+			return SearchHit{}, fmt.Errorf("failed to decode embedding of %s: %w", doc.ID, err)
+		}
+	}
+	return SearchHit{
+		ID:          index.articleID(doc.ID),
+		Title:       doc.Fields["title"],
+		Link:        doc.Fields["link"],
+		Site:        doc.Fields["site"],
+		PublishedAt: parseTimestamp(doc.Fields["published_at"]),
+		Text:        doc.Fields["text"],
+		Embedding:   embedding,
+	}, nil
+}
+
+// TextSearch performs a full-text search of the words of a query in the titles
+// of the articles, matching any of them, as a fallback of the vector search
+// when no query embedding can be computed. The hits are ranked by text
+// relevance, their score being relative to the most relevant one, and
+// opts.MinScore and opts.EFRuntime are ignored. Their distance is zero.
+func (c *Client) TextSearch(ctx context.Context, query string, k int, opts SearchOptions) ([]SearchHit, error) {
+	name, index := c.liveIndex(ctx)
+	terms := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) == 0 {
+		return []SearchHit{}, nil
+	}
+	textQuery := fmt.Sprintf("@title:(%s)", strings.Join(terms, "|"))
+	if filter := opts.filterQuery(); filter != "*" {
+		textQuery = fmt.Sprintf("%s %s", textQuery, filter)
+	}
+
+	returnFields := []redis.FTSearchReturn{
+		{FieldName: "title"},
+		{FieldName: "link"},
+		{FieldName: "site"},
+		{FieldName: "published_at"},
+		{FieldName: "text"},
+	}
+	if opts.WithEmbeddings {
+		returnFields = append(returnFields, redis.FTSearchReturn{FieldName: "embedding"})
+	}
+	searchResult, err := c.FTSearchWithArgs(ctx, name, textQuery, &redis.FTSearchOptions{
+		WithScores:     true,
+		DialectVersion: 2,
+		LimitOffset:    opts.Offset,
+		Limit:          k - opts.Offset,
+		Return:         returnFields,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("text search failed: %w", err)
+	}
+
+	results := make([]SearchHit, 0, len(searchResult.Docs))
+	for _, doc := range searchResult.Docs {
+		hit, err := newSearchHit(index, opts, doc)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Score != nil {
+			hit.Score = *doc.Score
+		}
+		results = append(results, hit)
+	}
+	if len(results) > 0 && results[0].Score > 0 {
+		top := results[0].Score
+		for i := range results {
+			results[i].Score = min(1, results[i].Score/top)
+		}
+	}
+	return results, nil
+}
+
+// ErrArticleNotFound is returned when an article is not in the store.
+var ErrArticleNotFound = errors.New("article not found")
+
+// SimilarArticles performs a KNN search with the embedding of a stored article,
+// to retrieve the k articles most similar to it. The article itself is excluded
+// from the results, and opts.Offset is ignored.
+func (c *Client) SimilarArticles(ctx context.Context, id string, k int, opts SearchOptions) ([]SearchHit, error) {
+	name, index := c.liveIndex(ctx)
+	embedding, err := c.HGet(ctx, index.articleKey(id), "embedding").Bytes()
+	if err == redis.Nil {
+		return nil, ErrArticleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get article embedding: %w", err)
+	}
+
+	// The article is its own nearest neighbour, when it matches the filters.
+	opts.Offset = 0
+	hits, err := c.knnSearch(ctx, name, index, embedding, k+1, opts)
+	if err != nil {
+		return nil, err
+	}
+	similar := make([]SearchHit, 0, len(hits))
+	for _, hit := range hits {
+		if hit.ID != id {
+			similar = append(similar, hit)
+		}
+	}
+	if len(similar) > k {
+		similar = similar[:k]
+	}
+	return similar, nil
+}
+
+// parseTimestamp parses a unix timestamp stored in a hash field. Missing or
+// invalid timestamps result in the zero time.
+func parseTimestamp(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// parseMilliTimestamp parses a unix timestamp in milliseconds stored in a
+// hash field. Missing or invalid values give the zero time.
+func parseMilliTimestamp(value string) time.Time {
+	milliseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(milliseconds).UTC()
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/segmentio/encoding/json"
+)
+
+const (
+	// SearchEventsStream is the key of the stream logging the searches.
+	SearchEventsStream = "gs_search_events"
+	// FeedbackEventsStream is the key of the stream logging the feedback on
+	// the search results.
+	FeedbackEventsStream = "gs_feedback_events"
+)
+
+// eventsStreamMaxLen is the approximate number of entries kept per stream,
+// the oldest ones being trimmed.
+const eventsStreamMaxLen = 1_000_000
+
+// SearchEvent is the analytics record of a search.
+type SearchEvent struct {
+	SearchID string
+	// Collection is the collection searched, empty for the default one.
+	Collection string
+	Query      string
+	Site       string
+	Limit      int
+	Offset     int
+	Variant    string
+	ResultIDs  []string
+	Latency    time.Duration
+	// Error is the error code of a failed search.
+	Error string
+	// Degraded is set when the search fell back to a text search.
+	Degraded bool
+}
+
+// FeedbackEvent is the analytics record of a feedback on a search.
+type FeedbackEvent struct {
+	SearchID string
+	// Type is the kind of feedback, such as a click or a thumbs up or down.
+	Type string
+	// ResultID is the article the feedback is about, if any.
+	ResultID string
+	// Rank is the 1-based rank of the result, if known.
+	Rank int
+}
+
+// LogSearch appends the search to the search events stream.
+// The result IDs are stored as a JSON array.
+func (c *Client) LogSearch(ctx context.Context, event SearchEvent) error {
+	resultIDs, err := json.Marshal(event.ResultIDs)
+	if err != nil {
+		return fmt.Errorf("failed to encode search %s results: %w", event.SearchID, err)
+	}
+	err = c.XAdd(ctx, &redis.XAddArgs{
+		Stream: SearchEventsStream,
+		MaxLen: eventsStreamMaxLen,
+		Approx: true,
+		Values: []interface{}{
+			"search_id", event.SearchID,
+			"collection", event.Collection,
+			"query", event.Query,
+			"site", event.Site,
+			"limit", event.Limit,
+			"offset", event.Offset,
+			"variant", event.Variant,
+			"result_ids", resultIDs,
+			"latency_ms", event.Latency.Milliseconds(),
+			"error", event.Error,
+			"degraded", event.Degraded,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to log search %s: %w", event.SearchID, err)
+	}
+	return nil
+}
+
+// LogFeedback appends the feedback to the feedback events stream.
+func (c *Client) LogFeedback(ctx context.Context, event FeedbackEvent) error {
+	err := c.XAdd(ctx, &redis.XAddArgs{
+		Stream: FeedbackEventsStream,
+		MaxLen: eventsStreamMaxLen,
+		Approx: true,
+		Values: []interface{}{
+			"search_id", event.SearchID,
+			"type", event.Type,
+			"result_id", event.ResultID,
+			"rank", event.Rank,
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to log feedback on search %s: %w", event.SearchID, err)
+	}
+	return nil
+}
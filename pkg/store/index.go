@@ -0,0 +1,336 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// IndexAlias is the alias the readers resolve the live index version through.
+// Swapping it to a new version is atomic.
+const IndexAlias = "gs_articles"
+
+// collectionKeyPrefix prefixes the keys of the articles of named collections.
+const collectionKeyPrefix = "collection:"
+
+// collectionPattern restricts the collection names, so that the names and
+// key prefixes of the collections do not overlap.
+var collectionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+const (
+	AlgorithmFlat = "FLAT"
+	AlgorithmHNSW = "HNSW"
+)
+
+var (
+	algorithms      = []string{AlgorithmFlat, AlgorithmHNSW}
+	distanceMetrics = []string{"COSINE", "L2", "IP"}
+	vectorTypes     = []string{"FLOAT32", "FLOAT64", "FLOAT16", "BFLOAT16"}
+)
+
+// IndexConfig holds the configuration of the vector index.
+// The fields are loaded from the environment with the INDEX_ prefix, except
+// the dimension which is shared with the vectorizer.
+type IndexConfig struct {
+	Dimension int `ignored:"true"`
+	// Collection is the collection of articles of the index. Each collection
+	// has its own indexes, key prefix, alias and suggestions. The default
+	// collection is unnamed, and keeps the names used before collections.
+	Collection string `envconfig:"COLLECTION"`
+	// Version is the version of the index. Each version has its own index name
+	// and key prefix, so that a new version is built alongside the live one.
+	Version        int    `envconfig:"VERSION" default:"1"`
+	Algorithm      string `envconfig:"ALGORITHM" default:"FLAT"`
+	DistanceMetric string `envconfig:"DISTANCE_METRIC" default:"COSINE"`
+	VectorType     string `envconfig:"VECTOR_TYPE" default:"FLOAT32"`
+	// M, EFConstruction and EFRuntime are the HNSW parameters. EFRuntime is
+	// the default of the queries, and may be changed without rebuilding the index.
+	M              int `envconfig:"HNSW_M" default:"16"`
+	EFConstruction int `envconfig:"HNSW_EF_CONSTRUCTION" default:"200"`
+	EFRuntime      int `envconfig:"HNSW_EF_RUNTIME" default:"10"`
+	// VectorizerAddr is the address of the vectorizer serving the model of
+	// the index version, recorded by the reindexer and read along with the
+	// live index. It is empty when none is recorded.
+	VectorizerAddr string `ignored:"true"`
+}
+
+// Validate checks the index configuration.
+func (c IndexConfig) Validate() error {
+	if c.Version <= 0 {
+		return fmt.Errorf("invalid version %d", c.Version)
+	}
+	if err := ValidateCollection(c.Collection); err != nil {
+		return err
+	}
+	if c.Dimension <= 0 {
+		return fmt.Errorf("invalid dimension %d", c.Dimension)
+	}
+	if !slices.Contains(algorithms, c.Algorithm) {
+		return fmt.Errorf("invalid algorithm %q, expected one of %v", c.Algorithm, algorithms)
+	}
+	if !slices.Contains(distanceMetrics, c.DistanceMetric) {
+		return fmt.Errorf("invalid distance metric %q, expected one of %v", c.DistanceMetric, distanceMetrics)
+	}
+	if !slices.Contains(vectorTypes, c.VectorType) {
+		return fmt.Errorf("invalid vector type %q, expected one of %v", c.VectorType, vectorTypes)
+	}
+	if c.Algorithm == AlgorithmHNSW && (c.M <= 0 || c.EFConstruction <= 0 || c.EFRuntime <= 0) {
+		return fmt.Errorf("invalid HNSW parameters M=%d EF_CONSTRUCTION=%d EF_RUNTIME=%d", c.M, c.EFConstruction, c.EFRuntime)
+	}
+	return nil
+}
+
+// Similarity converts a distance of the index metric to a similarity in
+// [0, 1], higher meaning more similar. COSINE and IP distances are one minus
+// the similarity of the vectors, which is clamped. L2 distances are unbounded
+// and mapped to 1 / (1 + distance).
+func (c IndexConfig) Similarity(distance float64) float64 {
+	if c.DistanceMetric == "L2" {
+		return 1 / (1 + max(distance, 0))
+	}
+	return min(max(1-distance, 0), 1)
+}
+
+// ValidateCollection checks a collection name: lowercase letters, digits and
+// dashes. The default collection has an empty name.
+func ValidateCollection(name string) error {
+	if name != "" && !collectionPattern.MatchString(name) {
+		return fmt.Errorf("invalid collection %q, expected lowercase letters, digits and dashes", name)
+	}
+	return nil
+}
+
+// collectionName returns the name of a store object of the default
+// collection, qualified with the collection of the index.
+func (c IndexConfig) collectionName(name string) string {
+	if c.Collection == "" {
+		return name
+	}
+	return name + ":" + c.Collection
+}
+
+// Name returns the name of the index. The first version keeps the name of the
+// index created before versioning.
+func (c IndexConfig) Name() string {
+	if c.Version <= 1 {
+		return c.collectionName(IndexName)
+	}
+	return fmt.Sprintf("%s_v%d", c.collectionName(IndexName), c.Version)
+}
+
+// Alias returns the alias of the live index of the collection.
+func (c IndexConfig) Alias() string {
+	return c.collectionName(IndexAlias)
+}
+
+// vectorizerKey returns the key of the vectorizer address of the index version.
+func (c IndexConfig) vectorizerKey() string {
+	return c.Name() + ":vectorizer"
+}
+
+// suggestionDictionary returns the key of the suggestions of the collection.
+func (c IndexConfig) suggestionDictionary() string {
+	return c.collectionName(SuggestionDictionary)
+}
+
+// KeyPrefix returns the prefix of the keys of the articles of the index. The
+// prefixes of the next versions do not start with ArticlePrefix, as the first
+// version would index their keys otherwise. Neither do the prefixes of the
+// named collections.
+func (c IndexConfig) KeyPrefix() string {
+	prefix := ArticlePrefix
+	if c.Version > 1 {
+		prefix = fmt.Sprintf("%s_v%d:", strings.TrimSuffix(ArticlePrefix, ":"), c.Version)
+	}
+	if c.Collection == "" {
+		return prefix
+	}
+	return collectionKeyPrefix + c.Collection + ":" + prefix
+}
+
+// articleKey returns the key of the hash storing an article.
+func (c IndexConfig) articleKey(id string) string {
+	return c.KeyPrefix() + id
+}
+
+// articleID returns the ID of the article stored at a key.
+func (c IndexConfig) articleID(key string) string {
+	return strings.TrimPrefix(key, c.KeyPrefix())
+}
+
+// versionFromName returns the version of an index of the collection from
+// its name.
+func (c IndexConfig) versionFromName(name string) (int, bool) {
+	base := c.collectionName(IndexName)
+	if name == base {
+		return 1, true
+	}
+	suffix, ok := strings.CutPrefix(name, base+"_v")
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(suffix)
+	if err != nil || version <= 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// The vectorizer generates FLOAT32 little-endian embeddings. They are the
+// embeddings exchanged with the clients of the store, and are converted from
+// and to the vector type of the index.
+
+// queryVector checks the dimension of a FLOAT32 query embedding, and converts
+// it to the vector type of the index.
+func (c IndexConfig) queryVector(embedding []byte) ([]byte, error) {
+	if c.Dimension > 0 && len(embedding) != c.Dimension*4 {
+		return nil, fmt.Errorf("%w: the query embedding has %d bytes, the index expects %d FLOAT32 dimensions", ErrDimensionMismatch, len(embedding), c.Dimension)
+	}
+	vector, err := c.encodeVector(embedding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode query embedding: %w", err)
+	}
+	return vector, nil
+}
+
+// encodeVector converts a FLOAT32 embedding to the vector type of the index.
+func (c IndexConfig) encodeVector(embedding []byte) ([]byte, error) {
+	if c.VectorType == "FLOAT32" || c.VectorType == "" {
+		return embedding, nil
+	}
+	if len(embedding)%4 != 0 {
+		return nil, fmt.Errorf("invalid FLOAT32 embedding length %d", len(embedding))
+	}
+
+	n := len(embedding) / 4
+	out := make([]byte, 0, n*vectorTypeSize(c.VectorType))
+	for i := 0; i < n; i++ {
+		f := math.Float32frombits(binary.LittleEndian.Uint32(embedding[i*4:]))
+		switch c.VectorType {
+		case "FLOAT64":
+			out = binary.LittleEndian.AppendUint64(out, math.Float64bits(float64(f)))
+		case "FLOAT16":
+			out = binary.LittleEndian.AppendUint16(out, float32ToFloat16(f))
+		case "BFLOAT16":
+			out = binary.LittleEndian.AppendUint16(out, float32ToBFloat16(f))
+		}
+	}
+	return out, nil
+}
+
+// decodeVector converts an embedding of the vector type of the index to FLOAT32.
+func (c IndexConfig) decodeVector(vector []byte) ([]byte, error) {
+	if c.VectorType == "FLOAT32" || c.VectorType == "" {
+		return vector, nil
+	}
+	size := vectorTypeSize(c.VectorType)
+	if len(vector)%size != 0 {
+		return nil, fmt.Errorf("invalid %s vector length %d", c.VectorType, len(vector))
+	}
+
+	n := len(vector) / size
+	out := make([]byte, 0, n*4)
+	for i := 0; i < n; i++ {
+		var f float32
+		switch c.VectorType {
+		case "FLOAT64":
+			f = float32(math.Float64frombits(binary.LittleEndian.Uint64(vector[i*size:])))
+		case "FLOAT16":
+			f = float16ToFloat32(binary.LittleEndian.Uint16(vector[i*size:]))
+		case "BFLOAT16":
+			f = math.Float32frombits(uint32(binary.LittleEndian.Uint16(vector[i*size:])) << 16)
+		}
+		out = binary.LittleEndian.AppendUint32(out, math.Float32bits(f))
+	}
+	return out, nil
+}
+
+func vectorTypeSize(vectorType string) int {
+	switch vectorType {
+	case "FLOAT64":
+		return 8
+	case "FLOAT16", "BFLOAT16":
+		return 2
+	default:
+		return 4
+	}
+}
+
+// float32ToBFloat16 truncates a float32 to a bfloat16, rounding to nearest even.
+func float32ToBFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	if f != f { // NaN must stay NaN after truncation.
+		return uint16(bits>>16) | 0x40
+	}
+	rounding := uint32(0x7fff) + (bits>>16)&1
+	return uint16((bits + rounding) >> 16)
+}
+
+// float32ToFloat16 converts a float32 to an IEEE 754 half precision float,
+// rounding to nearest even. Out of range values become infinities.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23&0xff) - 127 + 15
+	mantissa := bits & 0x7fffff
+
+	switch {
+	case bits&0x7fffffff == 0:
+		return sign
+	case bits>>23&0xff == 0xff: // Inf or NaN.
+		if mantissa != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		// Subnormal half, or zero when too small.
+		if exp < -10 {
+			return sign
+		}
+		mantissa |= 0x800000
+		shift := uint32(14 - exp)
+		half := uint16(mantissa >> shift)
+		remainder := mantissa & (1<<shift - 1)
+		midpoint := uint32(1) << (shift - 1)
+		if remainder > midpoint || (remainder == midpoint && half&1 == 1) {
+			half++
+		}
+		return sign | half
+	}
+
+	half := uint16(exp)<<10 | uint16(mantissa>>13)
+	remainder := mantissa & 0x1fff
+	if remainder > 0x1000 || (remainder == 0x1000 && half&1 == 1) {
+		half++ // May carry into the exponent, up to infinity, as expected.
+	}
+	return sign | half
+}
+
+// float16ToFloat32 converts an IEEE 754 half precision float to a float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mantissa := uint32(h & 0x3ff)
+
+	switch {
+	case exp == 0 && mantissa == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Subnormal half, normalized as a float32.
+		e := uint32(127 - 15 + 1)
+		for mantissa&0x400 == 0 {
+			mantissa <<= 1
+			e--
+		}
+		return math.Float32frombits(sign | e<<23 | (mantissa&0x3ff)<<13)
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0xff<<23 | mantissa<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mantissa<<13)
+}
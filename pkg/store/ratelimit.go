@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// rateLimitPrefix prefixes the keys of the rate limit buckets.
+const rateLimitPrefix = "gs_ratelimit:"
+
+// takeTokensScript takes tokens from a token bucket refilled at a rate per
+// second up to a burst, stored as a hash of its tokens and of the time they
+// were counted. The time of the Redis server is used, so that the replicas
+// of a service share their buckets whatever the skew of their clocks.
+// It returns whether the tokens were taken and, if not, the number of
+// milliseconds before they are available.
+var takeTokensScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens, ts = burst, now
+end
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed, wait = 0, 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	wait = math.ceil((cost - tokens) * 1000 / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
+`)
+
+// TakeTokens takes cost tokens from the bucket of a client, refilled at rate
+// tokens per second up to burst tokens. When the bucket lacks tokens, none is
+// taken and the wait before they are available is returned. The cost cannot
+// exceed the burst.
+func (c *Client) TakeTokens(ctx context.Context, bucket string, rate float64, burst, cost int) (bool, time.Duration, error) {
+	if rate <= 0 || burst <= 0 {
+		return false, 0, fmt.Errorf("invalid rate %v or burst %d", rate, burst)
+	}
+	if cost > burst {
+		return false, 0, fmt.Errorf("cost %d exceeds burst %d", cost, burst)
+	}
+	result, err := takeTokensScript.Run(ctx, c, []string{rateLimitPrefix + bucket}, rate, burst, cost).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take tokens of bucket %s: %w", bucket, err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected reply %v of bucket %s", result, bucket)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
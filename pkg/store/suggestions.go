@@ -0,0 +1,293 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SuggestionDictionary is the key of the dictionary of article titles used for
+// autocompletion, for the default collection.
+const SuggestionDictionary = "gs_suggestions"
+
+const (
+	// suggestionHalfLife is the duration after which the weight of a suggestion,
+	// or of a hit on it, is halved compared to recent ones.
+	suggestionHalfLife = 30 * 24 * time.Hour
+	// suggestionHitWeight is the weight of a hit on a suggestion, relatively to
+	// the weight of an article published at the same time.
+	suggestionHitWeight = 0.1
+	// suggestionRescaleAfter is the age of the epoch of a dictionary after
+	// which its scores are rescaled to a new epoch, which bounds the boosts to
+	// about 2^12, far from the precision and range limits of the scores.
+	suggestionRescaleAfter = 12 * suggestionHalfLife
+	// suggestionRescaleLockTTL bounds the time a rescaling holds its lock.
+	// A rescaling outliving it may run along with another one, the titles
+	// being rescaled once anyway.
+	suggestionRescaleLockTTL = 10 * time.Minute
+	// suggestionRescaleMatches is the number of suggestions starting with the
+	// title of an article searched for its own suggestion when rescaling.
+	suggestionRescaleMatches = 100
+)
+
+// defaultSuggestionEpoch is the reference time of the recency boosts of the
+// dictionaries without a stored epoch.
+var defaultSuggestionEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// recencyBoost returns a weight growing exponentially with time since the
+// epoch of a dictionary.
+// Instead of decaying all the scores of the dictionary over time, new entries
+// and increments are boosted: older contributions become relatively smaller.
+// The dictionary is rescaled to a new epoch before the boosts grow too large.
+func recencyBoost(epoch, t time.Time) float64 {
+	return math.Exp2(float64(t.Sub(epoch)) / float64(suggestionHalfLife))
+}
+
+// suggestionEpochKey returns the key of the epoch of a dictionary.
+func suggestionEpochKey(dictionary string) string {
+	return dictionary + ":epoch"
+}
+
+// parseSuggestionEpoch reads the epoch of a dictionary, stored as a unix
+// timestamp. The default epoch is used when none is stored.
+func parseSuggestionEpoch(cmd *redis.StringCmd) (time.Time, error) {
+	value, err := cmd.Result()
+	if err == redis.Nil {
+		return defaultSuggestionEpoch, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get suggestion epoch: %w", err)
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid suggestion epoch %q: %w", value, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// addSuggestionArgs returns the command adding the score to the suggestion of
+// a dictionary, creating it if needed. The article link is kept as the
+// suggestion payload.
+func addSuggestionArgs(dictionary, title, link string, score float64) []interface{} {
+	return []interface{}{"FT.SUGADD", dictionary, title, score, "INCR", "PAYLOAD", link}
+}
+
+// Suggestion is an article title completing a prefix.
+type Suggestion struct {
+	Title string
+	Link  string
+	Score float64
+}
+
+// Suggest returns up to max article titles starting with the prefix, by
+// decreasing score.
+func (c *Client) Suggest(ctx context.Context, prefix string, max int) ([]Suggestion, error) {
+	values, err := c.Do(ctx, "FT.SUGGET", c.index.suggestionDictionary(), prefix, "WITHSCORES", "WITHPAYLOADS", "MAX", max).Slice()
+	if err != nil {
+		if err == redis.Nil {
+			return []Suggestion{}, nil
+		}
+		return nil, fmt.Errorf("failed to get suggestions: %w", err)
+	}
+
+	// Each suggestion is a triplet of its title, score and payload.
+	suggestions := make([]Suggestion, 0, len(values)/3)
+	for i := 0; i+2 < len(values); i += 3 {
+		title, _ := values[i].(string)
+		scoreVal, _ := values[i+1].(string)
+		link, _ := values[i+2].(string)
+		score, err := strconv.ParseFloat(scoreVal, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse score of suggestion %q: %w", title, err)
+		}
+		suggestions = append(suggestions, Suggestion{Title: title, Link: link, Score: score})
+	}
+	return suggestions, nil
+}
+
+// RecordSuggestionHit increases the score of the suggestion of an article,
+// when it was clicked or searched. Titles of unknown articles are ignored.
+func (c *Client) RecordSuggestionHit(ctx context.Context, title string) error {
+	_, index := c.liveIndex(ctx)
+	dictionary := index.suggestionDictionary()
+	pipe := c.Pipeline()
+	linkCmd := pipe.HGet(ctx, index.articleKey(title), "link")
+	epochCmd := pipe.Get(ctx, suggestionEpochKey(dictionary))
+	// The missing article or epoch are read from their commands.
+	_, _ = pipe.Exec(ctx)
+	link, err := linkCmd.Result()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get article: %w", err)
+	}
+	epoch, err := parseSuggestionEpoch(epochCmd)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Do(ctx, addSuggestionArgs(dictionary, title, link, suggestionHitWeight*recencyBoost(epoch, time.Now()))...).Err(); err != nil {
+		return fmt.Errorf("failed to record suggestion hit: %w", err)
+	}
+	return nil
+}
+
+// rescaleSuggestionsScript rescales by a factor the suggestions of titles
+// not rescaled yet to the pending epoch, and marks them as rescaled, so that
+// an interrupted rescaling may be resumed without rescaling them twice. The
+// suggestion of a title is looked up among the suggestions starting with it.
+// It returns -1 when the pending epoch changed, that is when the rescaling
+// was completed by another client.
+var rescaleSuggestionsScript = redis.NewScript(`
+local dictionary, rescaled, pending = KEYS[1], KEYS[2], KEYS[3]
+if redis.call('GET', pending) ~= ARGV[1] then
+	return -1
+end
+local factor = tonumber(ARGV[2])
+local count = 0
+for i = 4, #ARGV do
+	local title = ARGV[i]
+	if redis.call('SADD', rescaled, title) == 1 then
+		local values = redis.call('FT.SUGGET', dictionary, title, 'WITHSCORES', 'WITHPAYLOADS', 'MAX', ARGV[3])
+		if values then
+			for j = 1, #values - 2, 3 do
+				if values[j] == title then
+					local score = string.format('%.17g', tonumber(values[j + 1]) * factor)
+					-- Without INCR, the score replaces the current one.
+					if values[j + 2] then
+						redis.call('FT.SUGADD', dictionary, title, score, 'PAYLOAD', values[j + 2])
+					else
+						redis.call('FT.SUGADD', dictionary, title, score)
+					end
+					count = count + 1
+					break
+				end
+			end
+		end
+	end
+end
+return count
+`)
+
+// releaseLockScript deletes a lock if it is still held with a token, rather
+// than expired and taken by another client.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RescaleSuggestions rescales the scores of the suggestion dictionary to a new
+// epoch, once the current one is older than suggestionRescaleAfter, and
+// reports whether it did. The suggestions are those of the stored articles,
+// which are scanned. The new epoch is stored as pending until all the
+// suggestions are rescaled, along with the titles already rescaled, so that an
+// interrupted rescaling is resumed by the next one. A lock ensures a single
+// client rescales at a time, and the titles are rescaled at most once even if
+// it expires. The hits recorded during the rescaling may be over-weighted.
+func (c *Client) RescaleSuggestions(ctx context.Context) (bool, error) {
+	if c.pinned {
+		// Pinned clients do not write to the dictionary.
+		return false, nil
+	}
+	_, index := c.liveIndex(ctx)
+	dictionary := index.suggestionDictionary()
+	epochKey := suggestionEpochKey(dictionary)
+	pendingKey, rescaledKey := epochKey+":pending", dictionary+":rescaled"
+
+	pipe := c.Pipeline()
+	epochCmd := pipe.Get(ctx, epochKey)
+	pendingCmd := pipe.Get(ctx, pendingKey)
+	// The missing epochs are read from their commands.
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return false, fmt.Errorf("failed to get suggestion epoch: %w", err)
+	}
+	epoch, err := parseSuggestionEpoch(epochCmd)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	pending := pendingCmd.Err() != redis.Nil
+	if pending {
+		// An interrupted rescaling is resumed to its epoch.
+		if now, err = parseSuggestionEpoch(pendingCmd); err != nil {
+			return false, err
+		}
+	} else if now.Sub(epoch) < suggestionRescaleAfter {
+		return false, nil
+	}
+
+	lockKey := dictionary + ":rescale"
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return false, fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	lockToken := hex.EncodeToString(token)
+	locked, err := c.SetNX(ctx, lockKey, lockToken, suggestionRescaleLockTTL).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock the suggestions: %w", err)
+	}
+	if !locked {
+		return false, nil
+	}
+	defer releaseLockScript.Run(context.WithoutCancel(ctx), c, []string{lockKey}, lockToken)
+
+	if !pending {
+		// Another client may have started the rescaling since the epochs were
+		// read, its pending epoch is kept then.
+		if err := c.SetNX(ctx, pendingKey, now.Unix(), 0).Err(); err != nil {
+			return false, fmt.Errorf("failed to set pending suggestion epoch: %w", err)
+		}
+		if now, err = parseSuggestionEpoch(c.Get(ctx, pendingKey)); err != nil {
+			return false, err
+		}
+	}
+
+	factor := 1 / recencyBoost(epoch, now)
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, index.KeyPrefix()+"*", scanBatchSize).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to scan articles: %w", err)
+		}
+
+		if len(keys) > 0 {
+			args := make([]interface{}, 0, len(keys)+3)
+			args = append(args, now.Unix(), strconv.FormatFloat(factor, 'g', -1, 64), suggestionRescaleMatches)
+			for _, key := range keys {
+				args = append(args, index.articleID(key))
+			}
+			result, err := rescaleSuggestionsScript.Run(ctx, c, []string{dictionary, rescaledKey, pendingKey}, args...).Int64()
+			if err != nil {
+				return false, fmt.Errorf("failed to rescale suggestions: %w", err)
+			}
+			if result < 0 {
+				return false, nil
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	// The epoch is switched along with the end of the rescaling.
+	pipe = c.TxPipeline()
+	pipe.Set(ctx, epochKey, now.Unix(), 0)
+	pipe.Del(ctx, pendingKey, rescaledKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, fmt.Errorf("failed to set suggestion epoch: %w", err)
+	}
+	log.Printf("Rescaled suggestions of %s to the epoch %s", dictionary, now.Format(time.RFC3339))
+	return true, nil
+}
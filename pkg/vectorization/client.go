@@ -2,6 +2,7 @@ package vectorization
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -11,6 +12,9 @@ import (
 	"github.com/segmentio/encoding/json"
 )
 
+// Timeout bounds the calls to the Vectorizer service.
+const Timeout = 30 * time.Second
+
 // Client is a shared HTTP client for the Vectorizer service.
 type Client struct {
 	baseURL    string
@@ -34,7 +38,7 @@ func New(baseURL string) *Client {
 	return &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout: Timeout,
 		},
 	}
 }
@@ -127,3 +131,49 @@ func (c *Client) Vectorize(text string) ([]byte, error) {
 
 	return embeddings[0], nil
 }
+
+// RerankResponse represents the reranking response from the Vectorizer service.
+type RerankResponse struct {
+	Scores []float64 `json:"scores"`
+}
+
+// Rerank scores the relevance of each document to the query with the
+// cross-encoder of the service. Higher scores mean more relevant documents,
+// and are returned in the same order as the input documents.
+// The request is abandoned when the context is done.
+func (c *Client) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("documents cannot be empty")
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{"query": query, "documents": documents})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/rerank", c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to reranker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("reranker returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var rerankResp RerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rerankResp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reranker response: %w", err)
+	}
+	if len(rerankResp.Scores) != len(documents) {
+		return nil, fmt.Errorf("expected %d scores, got %d", len(documents), len(rerankResp.Scores))
+	}
+	return rerankResp.Scores, nil
+}
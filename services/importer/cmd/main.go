@@ -23,6 +23,14 @@ type Config struct {
 	DebugMode           bool          `envconfig:"DEBUG_MODE" default:"false"`
 	EmbeddingDimension  int           `envconfig:"EMBEDDING_DIMENSION" default:"384"`
 	ImportMaxGoroutines int           `envconfig:"IMPORT_MAX_GOROUTINES" default:"1"`
+	// Index holds the vector index settings, read from the INDEX_ variables.
+	Index store.IndexConfig `envconfig:"INDEX"`
+	// IndexPinned imports into the configured index version rather than the
+	// live one, to feed the index of a search variant.
+	IndexPinned bool `envconfig:"INDEX_PINNED" default:"false"`
+	// Reconciliation of the stored articles with the target, disabled when zero.
+	ReconcileInterval       time.Duration `envconfig:"RECONCILE_INTERVAL" default:"24h"`
+	ReconcileMaxDeleteRatio float64       `envconfig:"RECONCILE_MAX_DELETE_RATIO" default:"0.05"`
 }
 
 func main() {
@@ -41,7 +49,12 @@ func main() {
 	})
 	logger := slog.New(handler).With("service", "importer")
 
-	redisClient := store.New(config.RedisAddr, config.RedisPassword, config.EmbeddingDimension)
+	config.Index.Dimension = config.EmbeddingDimension
+	if err := config.Index.Validate(); err != nil {
+		log.Fatalf("Invalid index config: %v", err)
+	}
+
+	redisClient := store.New(config.RedisAddr, config.RedisPassword, config.Index)
 	if err := redisClient.Ping(context.Background()); err != nil {
 		logger.Error("Failed to connect to Redis", "error", err)
 		log.Fatalf("Failed to connect to Redis: %v", err)
@@ -52,7 +65,34 @@ func main() {
 		logger.Warn("Vectorizer health check failed", "error", err)
 	}
 
+	opts := importer.Options{
+		ReconcileInterval:       config.ReconcileInterval,
+		ReconcileMaxDeleteRatio: config.ReconcileMaxDeleteRatio,
+	}
+	var articleStore importer.Store = redisClient
+	if config.IndexPinned {
+		articleStore = redisClient.WithIndex(config.Index)
+	} else {
+		// The articles are embedded with the vectorizer recorded with the live
+		// index version, which switches along with the alias.
+		opts.IndexVersions = indexVersions{client: redisClient}
+	}
+
 	// TODO: handle graceful shutdown. Not critical for the importer as it does not serve requests...
-	i := importer.New(config.TargetURL, redisClient, vectorizerClient, logger, config.ImportMaxGoroutines)
+	i := importer.New(config.TargetURL, articleStore, vectorizerClient, logger, config.ImportMaxGoroutines, opts)
 	i.Start(context.Background(), config.PollInterval)
 }
+
+// indexVersions resolves the live index version of the store.
+type indexVersions struct {
+	client *store.Client
+}
+
+func (v indexVersions) ResolveVersion(ctx context.Context) (importer.Store, string) {
+	live := v.client.Resolved(ctx)
+	return live, live.Config().VectorizerAddr
+}
+
+func (v indexVersions) NewVectorizer(addr string) importer.Vectorizer {
+	return vectorization.New(addr)
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/segmentio/encoding/json"
@@ -22,27 +23,66 @@ type Vectorizer interface {
 type Store interface {
 	CreateVectorIndex(ctx context.Context) error
 	StoreArticles(ctx context.Context, articles []store.Article) error
+	ListSiteArticles(ctx context.Context, site string) ([]store.ArticleRef, error)
+	DeleteArticles(ctx context.Context, ids []string) (int, error)
+	RescaleSuggestions(ctx context.Context) (bool, error)
+}
+
+// IndexVersions resolves the live index version, along with the vectorizer of
+// its model, so that the articles are embedded with the model of the version
+// they are stored in.
+type IndexVersions interface {
+	// ResolveVersion returns a store operating on the live index version, and
+	// the address of the vectorizer of its model, empty when none is recorded.
+	ResolveVersion(ctx context.Context) (Store, string)
+	// NewVectorizer returns the vectorizer of an address.
+	NewVectorizer(addr string) Vectorizer
+}
+
+// suggestionRescaleInterval is the interval between two checks of whether the
+// suggestion scores must be rescaled.
+const suggestionRescaleInterval = 24 * time.Hour
+
+// Options holds the optional settings of the importer.
+type Options struct {
+	// ReconcileInterval is the interval between two reconciliations of the
+	// stored articles with the target. Reconciliation is disabled when zero.
+	ReconcileInterval time.Duration
+	// ReconcileMaxDeleteRatio is the maximum ratio of the stored articles of
+	// the target a reconciliation may delete.
+	ReconcileMaxDeleteRatio float64
+	// IndexVersions resolves the index version each page of articles is
+	// stored in. The store and vectorizer of the importer are used when nil.
+	IndexVersions IndexVersions
 }
 
 // Importer represents the service importing articles from a target source.
 type Importer struct {
 	target           string
+	site             string
 	store            Store
 	vectorizerClient Vectorizer
 	logger           *slog.Logger
 	maxGoroutines    int
 	httpClient       *http.Client
+	opts             Options
+	// vectorizers are the vectorizers of the index versions, by address.
+	vectorizersMu sync.Mutex
+	vectorizers   map[string]Vectorizer
 }
 
 // New creates a new Importer instance.
-func New(url string, store Store, vectorizerClient Vectorizer, logger *slog.Logger, maxGoroutines int) *Importer {
+func New(url string, articleStore Store, vectorizerClient Vectorizer, logger *slog.Logger, maxGoroutines int, opts Options) *Importer {
 	return &Importer{
 		target:           url,
-		store:            store,
+		site:             store.SiteFromURL(url),
+		store:            articleStore,
 		vectorizerClient: vectorizerClient,
 		logger:           logger,
 		maxGoroutines:    maxGoroutines,
 		httpClient:       &http.Client{Timeout: 10 * time.Second},
+		opts:             opts,
+		vectorizers:      make(map[string]Vectorizer),
 	}
 }
 
@@ -58,9 +98,27 @@ func (i *Importer) Start(ctx context.Context, interval time.Duration) {
 		i.logger.Error("Failed to perform initial import", "error", err)
 	}
 
+	i.rescaleSuggestions(ctx)
+	rescaleTicker := time.NewTicker(suggestionRescaleInterval)
+	defer rescaleTicker.Stop()
+
+	// A nil channel never fires, when reconciliation is disabled.
+	var reconcileC <-chan time.Time
+	if i.opts.ReconcileInterval > 0 {
+		reconcileTicker := time.NewTicker(i.opts.ReconcileInterval)
+		defer reconcileTicker.Stop()
+		reconcileC = reconcileTicker.C
+	}
+
 	i.logger.Info("Starting iterative pulling", "target", i.target, "interval", interval.Seconds())
 	for {
 		select {
+		case <-rescaleTicker.C:
+			i.rescaleSuggestions(ctx)
+		case <-reconcileC:
+			if err := i.reconcile(ctx); err != nil {
+				i.logger.Error("Failed to reconcile articles", "error", err)
+			}
 		case <-ticker.C:
 			// TODO: make number of posts configurable.
 			i.logger.Info("Pulling 20 latest posts", "target", i.target)
@@ -75,11 +133,30 @@ func (i *Importer) Start(ctx context.Context, interval time.Duration) {
 	}
 }
 
+// rescaleSuggestions rescales the suggestion scores when they are due, which
+// keeps their recency boosts bounded.
+func (i *Importer) rescaleSuggestions(ctx context.Context) {
+	rescaled, err := i.store.RescaleSuggestions(ctx)
+	if err != nil {
+		i.logger.Error("Failed to rescale suggestions", "error", err)
+		return
+	}
+	if rescaled {
+		i.logger.Info("Rescaled suggestions")
+	}
+}
+
 // Article represents the data from a website post.
 type Article struct {
 	Title       string
 	Description string
 	Link        string
+	PublishedAt time.Time
+}
+
+// text returns the text to vectorize for the article.
+func (a Article) text() string {
+	return fmt.Sprintf("%s. %s", a.Title, a.Description)
 }
 
 // VectorizedArticle represents an article along with its embedding.
@@ -118,18 +195,39 @@ func (i *Importer) initialImport(ctx context.Context) error {
 	return nil
 }
 
+// liveVersion returns the store of the live index version, and the vectorizer
+// of its model, the vectorizer of the importer when none is recorded.
+func (i *Importer) liveVersion(ctx context.Context) (Store, Vectorizer) {
+	if i.opts.IndexVersions == nil {
+		return i.store, i.vectorizerClient
+	}
+	versionStore, addr := i.opts.IndexVersions.ResolveVersion(ctx)
+	if addr == "" {
+		return versionStore, i.vectorizerClient
+	}
+
+	i.vectorizersMu.Lock()
+	defer i.vectorizersMu.Unlock()
+	vectorizer, ok := i.vectorizers[addr]
+	if !ok {
+		vectorizer = i.opts.IndexVersions.NewVectorizer(addr)
+		i.vectorizers[addr] = vectorizer
+	}
+	return versionStore, vectorizer
+}
+
 // vectorizeArticle generates the embeddings for given articles.
-func (i *Importer) vectorizeArticles(articles []Article) ([]VectorizedArticle, error) {
+func (i *Importer) vectorizeArticles(vectorizer Vectorizer, articles []Article) ([]VectorizedArticle, error) {
 	textsToVectorize := make([]string, 0, len(articles))
 	for _, article := range articles {
 		if article.Description == "" {
 			i.logger.Warn("Article has empty description, vectorizing only the title", "title", article.Title)
 		}
-		textsToVectorize = append(textsToVectorize, fmt.Sprintf("%s. %s", article.Title, article.Description))
+		textsToVectorize = append(textsToVectorize, article.text())
 	}
 
 	// Use batch vectorization - sends all texts in a single request
-	embeddings, err := i.vectorizerClient.VectorizeBatch(textsToVectorize)
+	embeddings, err := vectorizer.VectorizeBatch(textsToVectorize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to vectorize articles in batch: %w", err)
 	}
@@ -147,17 +245,20 @@ func (i *Importer) vectorizeArticles(articles []Article) ([]VectorizedArticle, e
 }
 
 // storeArticles stores the vectorized articles.
-func (i *Importer) storeArticles(ctx context.Context, vectorizedArticles []VectorizedArticle) error {
+func (i *Importer) storeArticles(ctx context.Context, articleStore Store, vectorizedArticles []VectorizedArticle) error {
 	articles := make([]store.Article, 0, len(vectorizedArticles))
 	for _, va := range vectorizedArticles {
 		articles = append(articles, store.Article{
-			Title:     va.Article.Title,
-			Link:      va.Article.Link,
-			Embedding: va.Embedding,
+			Title:       va.Article.Title,
+			Link:        va.Article.Link,
+			Site:        i.site,
+			PublishedAt: va.Article.PublishedAt,
+			Text:        va.Article.text(),
+			Embedding:   va.Embedding,
 		})
 	}
 
-	if err := i.store.StoreArticles(ctx, articles); err != nil {
+	if err := articleStore.StoreArticles(ctx, articles); err != nil {
 		i.logger.Error("Failed to store articles", "error", err)
 		return fmt.Errorf("failed to store articles: %w", err)
 	}
@@ -171,8 +272,12 @@ type WPPost struct {
 	Title   map[string]interface{} `json:"title"`
 	Excerpt map[string]interface{} `json:"excerpt"`
 	Link    string                 `json:"link"`
+	DateGMT string                 `json:"date_gmt"`
 }
 
+// wpDateLayout is the layout of the dates returned by the WordPress REST API.
+const wpDateLayout = "2006-01-02T15:04:05"
+
 func (i *Importer) vectorizePostsPage(ctx context.Context, page, hitsPerPage int) (int, error) {
 	posts, nbPages, err := i.fetchPostsPage(page, hitsPerPage)
 	if err != nil {
@@ -183,27 +288,41 @@ func (i *Importer) vectorizePostsPage(ctx context.Context, page, hitsPerPage int
 	for _, post := range posts {
 		title, _ := post.Title["rendered"].(string)
 		excerpt, _ := post.Excerpt["rendered"].(string)
+		publishedAt, err := time.Parse(wpDateLayout, post.DateGMT)
+		if err != nil && post.DateGMT != "" {
+			i.logger.Warn("Failed to parse post date", "error", err, "link", post.Link)
+		}
 		articles = append(articles, Article{
 			Title:       title,
 			Description: excerpt,
 			Link:        post.Link,
+			PublishedAt: publishedAt,
 		})
 	}
 	i.logger.Debug("Fetched page", "page", page, "article_count", len(posts), "max_pages", nbPages)
 
-	vectorizedArticles, err := i.vectorizeArticles(articles)
+	// The page is embedded and stored with a single index version, whatever
+	// swap of the alias happens meanwhile.
+	articleStore, vectorizer := i.liveVersion(ctx)
+	vectorizedArticles, err := i.vectorizeArticles(vectorizer, articles)
 	if err != nil {
 		return 0, fmt.Errorf("failed to vectorize articles: %w", err)
 	}
 
-	if err := i.storeArticles(ctx, vectorizedArticles); err != nil {
+	if err := i.storeArticles(ctx, articleStore, vectorizedArticles); err != nil {
 		return 0, fmt.Errorf("failed to store articles: %w", err)
 	}
 	return nbPages, nil
 }
 
 func (i *Importer) fetchPostsPage(page, hitsPerPage int) ([]WPPost, int, error) {
-	url := fmt.Sprintf("%s/wp-json/wp/v2/posts?_fields=title,excerpt,link&per_page=%d&page=%d", i.target, hitsPerPage, page)
+	url := fmt.Sprintf("%s/wp-json/wp/v2/posts?_fields=title,excerpt,link,date_gmt&per_page=%d&page=%d", i.target, hitsPerPage, page)
+	return i.fetchPosts(url)
+}
+
+// fetchPosts fetches a page of posts from the WordPress REST API, and returns
+// the total number of pages.
+func (i *Importer) fetchPosts(url string) ([]WPPost, int, error) {
 	resp, err := i.httpClient.Get(url)
 	if err != nil {
 		return nil, 0, fmt.Errorf("failed to create request: %w", err)
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -44,6 +45,8 @@ type mockStore struct {
 	indexErr       error
 	mtx            sync.Mutex // Protects storedArticles.
 	storedArticles []store.Article
+	articleRefs    []store.ArticleRef
+	deletedIDs     []string
 }
 
 func (m *mockStore) CreateVectorIndex(ctx context.Context) error {
@@ -60,15 +63,38 @@ func (m *mockStore) StoreArticles(ctx context.Context, articles []store.Article)
 	return nil
 }
 
+func (m *mockStore) ListSiteArticles(ctx context.Context, site string) ([]store.ArticleRef, error) {
+	if m.storeErr != nil {
+		return nil, m.storeErr
+	}
+	return m.articleRefs, nil
+}
+
+func (m *mockStore) RescaleSuggestions(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) DeleteArticles(ctx context.Context, ids []string) (int, error) {
+	if m.storeErr != nil {
+		return 0, m.storeErr
+	}
+	m.deletedIDs = append(m.deletedIDs, ids...)
+	return len(ids), nil
+}
+
 // buildWordPressResponse converts articles to WordPress post format and writes JSON response.
 func buildWordPressResponse(w http.ResponseWriter, articles []Article) error {
 	var posts []map[string]interface{}
 	for _, article := range articles {
-		posts = append(posts, map[string]interface{}{
+		post := map[string]interface{}{
 			"title":   map[string]string{"rendered": article.Title},
 			"excerpt": map[string]string{"rendered": article.Description},
 			"link":    article.Link,
-		})
+		}
+		if !article.PublishedAt.IsZero() {
+			post["date_gmt"] = article.PublishedAt.Format(wpDateLayout)
+		}
+		posts = append(posts, post)
 	}
 
 	jsonData, err := json.Marshal(posts)
@@ -157,6 +183,7 @@ func TestVectorizePostsPage(t *testing.T) {
 					Title:       "Test Article 1",
 					Description: "This is the first test article",
 					Link:        "https://example.com/article1",
+					PublishedAt: time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC),
 				},
 				{
 					Title:       "Test Article 2",
@@ -268,7 +295,7 @@ func TestVectorizePostsPage(t *testing.T) {
 			defer server.Close()
 
 			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-			importer := New(server.URL, tc.mockStore, tc.mockVectorizer, logger, 5)
+			importer := New(server.URL, tc.mockStore, tc.mockVectorizer, logger, 5, Options{})
 			nbPages, err := importer.vectorizePostsPage(context.Background(), 1, 10)
 
 			if tc.expectError {
@@ -282,6 +309,9 @@ func TestVectorizePostsPage(t *testing.T) {
 			assert.Equal(t, len(tc.mockStore.storedArticles), tc.expectedArticles)
 			for i, storedArticle := range tc.mockStore.storedArticles {
 				assert.Equal(t, storedArticle.Title, tc.expectedTitles[i])
+				assert.Equal(t, "127.0.0.1", storedArticle.Site)
+				assert.Equal(t, tc.articles[i].PublishedAt, storedArticle.PublishedAt)
+				assert.Equal(t, tc.articles[i].Title+". "+tc.articles[i].Description, storedArticle.Text)
 				if tc.validateEmbeddings {
 					assert.Equal(t, storedArticle.Embedding, tc.mockVectorizer.embeddings[i])
 				}
@@ -290,6 +320,55 @@ func TestVectorizePostsPage(t *testing.T) {
 	}
 }
 
+// mockIndexVersions implements the IndexVersions interface for testing.
+type mockIndexVersions struct {
+	store       *mockStore
+	addr        string
+	vectorizers map[string]*mockVectorizer
+}
+
+func (m *mockIndexVersions) ResolveVersion(ctx context.Context) (Store, string) {
+	return m.store, m.addr
+}
+
+func (m *mockIndexVersions) NewVectorizer(addr string) Vectorizer {
+	return m.vectorizers[addr]
+}
+
+func TestVectorizePostsPageLiveVersion(t *testing.T) {
+	t.Parallel()
+	mock := &wpServerMock{
+		t:          t,
+		articles:   []Article{{Title: "Test Article", Description: "Description", Link: "https://example.com/article"}},
+		totalPages: 1,
+		statusCode: http.StatusOK,
+	}
+	server := mock.Listen()
+	defer server.Close()
+
+	importerStore, versionStore := &mockStore{}, &mockStore{}
+	versions := &mockIndexVersions{
+		store:       versionStore,
+		vectorizers: map[string]*mockVectorizer{"http://vectorizer-v2:8080": {embeddings: [][]byte{[]byte("embedding-v2")}}},
+	}
+	importer := New(server.URL, importerStore, &mockVectorizer{embeddings: [][]byte{[]byte("embedding-v1")}},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), 1, Options{IndexVersions: versions})
+
+	// The importer vectorizer is used until a vectorizer is recorded with the
+	// live version.
+	_, err := importer.vectorizePostsPage(context.Background(), 1, 10)
+	require.NoError(t, err)
+	require.Len(t, versionStore.storedArticles, 1)
+	assert.Equal(t, []byte("embedding-v1"), versionStore.storedArticles[0].Embedding)
+
+	versions.addr = "http://vectorizer-v2:8080"
+	_, err = importer.vectorizePostsPage(context.Background(), 1, 10)
+	require.NoError(t, err)
+	require.Len(t, versionStore.storedArticles, 2)
+	assert.Equal(t, []byte("embedding-v2"), versionStore.storedArticles[1].Embedding)
+	assert.Empty(t, importerStore.storedArticles)
+}
+
 func TestInitialImport(t *testing.T) {
 	t.Parallel()
 	testCases := []struct {
@@ -364,7 +443,7 @@ func TestInitialImport(t *testing.T) {
 			defer server.Close()
 
 			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-			importer := New(server.URL, tc.mockStore, tc.mockVectorizer, logger, tc.maxGoroutines)
+			importer := New(server.URL, tc.mockStore, tc.mockVectorizer, logger, tc.maxGoroutines, Options{})
 			err := importer.initialImport(context.Background())
 			if tc.expectError {
 				require.Error(t, err)
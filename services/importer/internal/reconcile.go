@@ -0,0 +1,199 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+	"golang.org/x/sync/errgroup"
+)
+
+// reconcilePageSize is the number of posts per page when walking the target.
+const reconcilePageSize = 100
+
+// reconcile deletes the stored articles of the target that are no longer
+// published on it. Nothing is deleted when the target could not be fully
+// walked, or when the deletions would exceed the safety threshold, so that a
+// broken upstream response does not wipe the index.
+func (i *Importer) reconcile(ctx context.Context) error {
+	startedAt := time.Now()
+	published, err := i.fetchPublishedLinks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list published posts: %w", err)
+	}
+	if len(published) == 0 {
+		return fmt.Errorf("target returned no published posts, skipping reconciliation")
+	}
+
+	stored, err := i.store.ListSiteArticles(ctx, i.site)
+	if err != nil {
+		return fmt.Errorf("failed to list stored articles: %w", err)
+	}
+
+	var candidates []store.ArticleRef
+	for _, article := range stored {
+		// Articles published during the walk may have been missed by it.
+		if article.PublishedAt.After(startedAt) {
+			continue
+		}
+		if _, ok := published[article.Link]; !ok {
+			candidates = append(candidates, article)
+		}
+	}
+	if len(candidates) == 0 {
+		i.logger.Info("Reconciliation completed, no article to delete", "site", i.site, "stored", len(stored))
+		return nil
+	}
+
+	if ratio := float64(len(candidates)) / float64(len(stored)); ratio > i.opts.ReconcileMaxDeleteRatio {
+		return fmt.Errorf("reconciliation would delete %d of %d stored articles, above the %.0f%% safety threshold",
+			len(candidates), len(stored), i.opts.ReconcileMaxDeleteRatio*100)
+	}
+
+	toDelete, err := i.confirmUnpublished(ctx, candidates)
+	if err != nil {
+		return fmt.Errorf("failed to check unpublished posts: %w", err)
+	}
+	if len(toDelete) == 0 {
+		i.logger.Info("Reconciliation completed, the missing posts are still published", "site", i.site, "stored", len(stored))
+		return nil
+	}
+
+	deleted, err := i.store.DeleteArticles(ctx, toDelete)
+	if err != nil {
+		return fmt.Errorf("failed to delete unpublished articles: %w", err)
+	}
+	i.logger.Info("Reconciliation completed", "site", i.site, "stored", len(stored), "deleted", deleted)
+	return nil
+}
+
+// fetchPublishedLinks walks all the posts of the target and returns their
+// links. Posts are walked by ascending ID, so that posts published during the
+// walk do not shift the pages. Posts unpublished during the walk still shift
+// the next pages back, and the post shifted to a previous page is missed: the
+// links missing from the walk are checked again by confirmUnpublished.
+func (i *Importer) fetchPublishedLinks(ctx context.Context) (map[string]struct{}, error) {
+	fetchPage := func(page int) ([]WPPost, int, error) {
+		url := fmt.Sprintf("%s/wp-json/wp/v2/posts?_fields=link&orderby=id&order=asc&per_page=%d&page=%d", i.target, reconcilePageSize, page)
+		return i.fetchPosts(url)
+	}
+
+	posts, nbPages, err := fetchPage(1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page 1: %w", err)
+	}
+
+	var mtx sync.Mutex // Protects links.
+	links := make(map[string]struct{}, nbPages*reconcilePageSize)
+	for _, post := range posts {
+		links[post.Link] = struct{}{}
+	}
+
+	grp, ctx := errgroup.WithContext(ctx)
+	grp.SetLimit(i.maxGoroutines)
+	for page := 2; page <= nbPages; page++ {
+		grp.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			posts, _, err := fetchPage(page)
+			if err != nil {
+				return fmt.Errorf("failed to fetch page %d: %w", page, err)
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			for _, post := range posts {
+				links[post.Link] = struct{}{}
+			}
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// confirmUnpublished looks the candidates for deletion up individually, and
+// returns the IDs of the ones no longer published. The posts are looked up by
+// the slug ending their link, or by their ID for the numeric links: the
+// candidates whose link ends with neither are kept.
+func (i *Importer) confirmUnpublished(ctx context.Context, candidates []store.ArticleRef) ([]string, error) {
+	var slugs, ids []string
+	for _, candidate := range candidates {
+		slug, id := postLookup(candidate.Link)
+		if slug != "" {
+			slugs = append(slugs, slug)
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	published := make(map[string]struct{}, len(candidates))
+	lookup := func(param string, values []string) error {
+		for start := 0; start < len(values); start += reconcilePageSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			batch := values[start:min(start+reconcilePageSize, len(values))]
+			lookupURL := fmt.Sprintf("%s/wp-json/wp/v2/posts?_fields=link&per_page=%d&%s=%s", i.target, reconcilePageSize, param, url.QueryEscape(strings.Join(batch, ",")))
+			posts, _, err := i.fetchPosts(lookupURL)
+			if err != nil {
+				return err
+			}
+			for _, post := range posts {
+				published[post.Link] = struct{}{}
+			}
+		}
+		return nil
+	}
+	if err := lookup("slug", slugs); err != nil {
+		return nil, err
+	}
+	if err := lookup("include", ids); err != nil {
+		return nil, err
+	}
+
+	var unpublished []string
+	for _, candidate := range candidates {
+		if slug, id := postLookup(candidate.Link); slug == "" && id == "" {
+			continue
+		}
+		if _, ok := published[candidate.Link]; !ok {
+			unpublished = append(unpublished, candidate.ID)
+		}
+	}
+	return unpublished, nil
+}
+
+// postLookup returns the slug or the ID a post can be looked up by, from its
+// link: the ID of the plain links, such as "/?p=123", or of the numeric ones,
+// such as "/archives/123", and the slug ending the others.
+func postLookup(link string) (slug, id string) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", ""
+	}
+	if p := u.Query().Get("p"); p != "" {
+		if _, err := strconv.ParseUint(p, 10, 64); err == nil {
+			return "", p
+		}
+		return "", ""
+	}
+	last := path.Base(strings.TrimSuffix(u.Path, "/"))
+	if last == "." || last == "/" {
+		return "", ""
+	}
+	if _, err := strconv.ParseUint(last, 10, 64); err == nil {
+		return "", last
+	}
+	return last, ""
+}
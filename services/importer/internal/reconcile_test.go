@@ -0,0 +1,229 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	published := []Article{
+		{Link: "http://test.com/1"},
+		{Link: "http://test.com/2"},
+		{Link: "http://test.com/3"},
+	}
+	stored := []store.ArticleRef{
+		{ID: "Article 1", Link: "http://test.com/1"},
+		{ID: "Article 2", Link: "http://test.com/2"},
+		{ID: "Article 3", Link: "http://test.com/3"},
+	}
+
+	testCases := []struct {
+		name            string
+		articles        []Article
+		totalPages      int
+		statusCode      int
+		storedRefs      []store.ArticleRef
+		storeErr        error
+		maxDeleteRatio  float64
+		expectError     bool
+		errorContains   string
+		expectedDeleted []string
+	}{
+		{
+			name:           "NothingToDelete",
+			articles:       published,
+			totalPages:     1,
+			statusCode:     http.StatusOK,
+			storedRefs:     stored,
+			maxDeleteRatio: 0.5,
+		},
+		{
+			name:       "DeleteUnpublished",
+			articles:   published[:2],
+			totalPages: 1,
+			statusCode: http.StatusOK,
+			storedRefs: append(stored, store.ArticleRef{
+				// Published after the walk started, it must be kept.
+				ID: "Article 4", Link: "http://test.com/4", PublishedAt: time.Now().Add(time.Hour),
+			}),
+			maxDeleteRatio:  0.5,
+			expectedDeleted: []string{"Article 3"},
+		},
+		{
+			name:           "AboveSafetyThreshold",
+			articles:       published[:1],
+			totalPages:     1,
+			statusCode:     http.StatusOK,
+			storedRefs:     stored,
+			maxDeleteRatio: 0.5,
+			expectError:    true,
+			errorContains:  "safety threshold",
+		},
+		{
+			name:           "EmptyTarget",
+			articles:       []Article{},
+			totalPages:     0,
+			statusCode:     http.StatusOK,
+			storedRefs:     stored,
+			maxDeleteRatio: 1,
+			expectError:    true,
+			errorContains:  "no published posts",
+		},
+		{
+			name:           "TargetError",
+			totalPages:     1,
+			statusCode:     http.StatusBadGateway,
+			storedRefs:     stored,
+			maxDeleteRatio: 1,
+			expectError:    true,
+			errorContains:  "failed to list published posts",
+		},
+		{
+			name:           "StoreError",
+			articles:       published,
+			totalPages:     1,
+			statusCode:     http.StatusOK,
+			storeErr:       errors.New("connection refused"),
+			maxDeleteRatio: 1,
+			expectError:    true,
+			errorContains:  "failed to list stored articles",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mock := &wpServerMock{
+				t:          t,
+				articles:   tc.articles,
+				totalPages: tc.totalPages,
+				statusCode: tc.statusCode,
+			}
+			server := mock.Listen()
+			defer server.Close()
+
+			mockStore := &mockStore{articleRefs: tc.storedRefs, storeErr: tc.storeErr}
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			importer := New(server.URL, mockStore, &mockVectorizer{}, logger, 2, Options{
+				ReconcileMaxDeleteRatio: tc.maxDeleteRatio,
+			})
+
+			err := importer.reconcile(context.Background())
+			if tc.expectError {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.errorContains)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedDeleted, mockStore.deletedIDs)
+		})
+	}
+}
+
+func TestFetchPublishedLinksMultiplePages(t *testing.T) {
+	t.Parallel()
+	mock := &wpServerMock{
+		t:          t,
+		articles:   []Article{{Link: "http://test.com/1"}},
+		totalPages: 4,
+		statusCode: http.StatusOK,
+	}
+	server := mock.Listen()
+	defer server.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	importer := New(server.URL, &mockStore{}, &mockVectorizer{}, logger, 2, Options{})
+	links, err := importer.fetchPublishedLinks(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"http://test.com/1": {}}, links)
+	assert.Equal(t, 4, mock.pageRequests)
+}
+
+func TestReconcileUnpublishedDuringWalk(t *testing.T) {
+	t.Parallel()
+	posts := []Article{
+		{Link: "http://test.com/post-1"},
+		{Link: "http://test.com/post-2"},
+		{Link: "http://test.com/post-3"},
+		{Link: "http://test.com/post-4"},
+	}
+	var mtx sync.Mutex // Protects posts.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		query := r.URL.Query()
+		w.Header().Set("X-WP-TotalPages", "2")
+		if slugs := query.Get("slug"); slugs != "" {
+			var found []Article
+			for _, post := range posts {
+				if slices.Contains(strings.Split(slugs, ","), strings.TrimPrefix(post.Link, "http://test.com/")) {
+					found = append(found, post)
+				}
+			}
+			require.NoError(t, buildWordPressResponse(w, found))
+			return
+		}
+
+		// Pages hold two posts, and post 2 is unpublished once the first
+		// page is served: post 3 shifts to the first page.
+		page, err := strconv.Atoi(query.Get("page"))
+		require.NoError(t, err)
+		start := min((page-1)*2, len(posts))
+		require.NoError(t, buildWordPressResponse(w, posts[start:min(start+2, len(posts))]))
+		if page == 1 {
+			posts = slices.Delete(posts, 1, 2)
+		}
+	}))
+	defer server.Close()
+
+	stored := []store.ArticleRef{
+		{ID: "Post 1", Link: "http://test.com/post-1"},
+		{ID: "Post 2", Link: "http://test.com/post-2"},
+		{ID: "Post 3", Link: "http://test.com/post-3"},
+		{ID: "Post 4", Link: "http://test.com/post-4"},
+		{ID: "Post 5", Link: "http://test.com/post-5"},
+	}
+	mockStore := &mockStore{articleRefs: stored}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	importer := New(server.URL, mockStore, &mockVectorizer{}, logger, 2, Options{ReconcileMaxDeleteRatio: 1})
+
+	require.NoError(t, importer.reconcile(context.Background()))
+	// Post 3, missed by the walk, is kept.
+	assert.Equal(t, []string{"Post 5"}, mockStore.deletedIDs)
+}
+
+func TestPostLookup(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		link string
+		slug string
+		id   string
+	}{
+		{link: "https://example.com/2024/01/my-post/", slug: "my-post"},
+		{link: "https://example.com/my-post", slug: "my-post"},
+		{link: "https://example.com/?p=123", id: "123"},
+		{link: "https://example.com/archives/123", id: "123"},
+		{link: "https://example.com/"},
+		{link: "https://example.com/?p=abc"},
+	}
+
+	for _, tc := range testCases {
+		slug, id := postLookup(tc.link)
+		assert.Equal(t, tc.slug, slug, tc.link)
+		assert.Equal(t, tc.id, id, tc.link)
+	}
+}
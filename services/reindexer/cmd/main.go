@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/turanic/gs_search/pkg/store"
+	"github.com/turanic/gs_search/pkg/vectorization"
+	reindexer "github.com/turanic/gs_search/services/reindexer/internal"
+)
+
+// Config holds the configuration for the reindexer job.
+type Config struct {
+	RedisAddr      string `envconfig:"REDIS_ADDR"`
+	RedisPassword  string `envconfig:"REDIS_PASSWORD"`
+	VectorizerAddr string `envconfig:"VECTORIZER_ADDR"`
+	// ReindexVectorizerAddr is the vectorizer of the model of the index
+	// version to build, VECTORIZER_ADDR when empty. It is recorded with the
+	// index, and the other services switch to it along with the alias.
+	ReindexVectorizerAddr string `envconfig:"REINDEX_VECTORIZER_ADDR"`
+	DebugMode             bool   `envconfig:"DEBUG_MODE" default:"false"`
+	EmbeddingDimension    int    `envconfig:"EMBEDDING_DIMENSION" default:"384"`
+	// Index holds the settings of the index version to build, read from the INDEX_ variables.
+	Index            store.IndexConfig `envconfig:"INDEX"`
+	ReindexReembed   bool              `envconfig:"REINDEX_REEMBED" default:"true"`
+	ReindexBatchSize int               `envconfig:"REINDEX_BATCH_SIZE" default:"100"`
+	ReindexSwap      bool              `envconfig:"REINDEX_SWAP" default:"true"`
+	// ReindexSwapGrace must exceed the time the clients cache the alias resolution.
+	ReindexSwapGrace time.Duration `envconfig:"REINDEX_SWAP_GRACE" default:"30s"`
+}
+
+func main() {
+	var config Config
+	if err := envconfig.Process("", &config); err != nil {
+		log.Fatalf("Failed to process config: %v", err)
+	}
+
+	logLevel := slog.LevelInfo
+	if config.DebugMode {
+		logLevel = slog.LevelDebug
+	}
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: logLevel,
+	})
+	logger := slog.New(handler).With("service", "reindexer")
+
+	config.Index.Dimension = config.EmbeddingDimension
+	if err := config.Index.Validate(); err != nil {
+		log.Fatalf("Invalid index config: %v", err)
+	}
+	if config.ReindexBatchSize <= 0 {
+		log.Fatalf("Invalid reindex batch size %d", config.ReindexBatchSize)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	redisClient := store.New(config.RedisAddr, config.RedisPassword, config.Index)
+	defer redisClient.Close()
+	if err := redisClient.Ping(ctx); err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+	live, err := redisClient.LiveIndex(ctx)
+	if err != nil {
+		// Importers add the alias to the existing index on startup.
+		log.Fatalf("Failed to resolve the live index: %v", err)
+	}
+
+	if config.ReindexVectorizerAddr == "" {
+		config.ReindexVectorizerAddr = config.VectorizerAddr
+	}
+	vectorizerClient := vectorization.New(config.ReindexVectorizerAddr)
+	if config.ReindexReembed {
+		if err := vectorizerClient.HealthCheck(); err != nil {
+			logger.Warn("Vectorizer health check failed", "error", err)
+		}
+	}
+
+	r := reindexer.New(redisClient.WithIndex(live), redisClient.WithIndex(config.Index), vectorizerClient, logger, reindexer.Options{
+		Reembed:        config.ReindexReembed,
+		VectorizerAddr: config.ReindexVectorizerAddr,
+		BatchSize:      config.ReindexBatchSize,
+		Swap:           config.ReindexSwap,
+		SwapGrace:      config.ReindexSwapGrace,
+	})
+	if err := r.Run(ctx); err != nil {
+		logger.Error("Reindexing failed", "error", err)
+		os.Exit(1)
+	}
+}
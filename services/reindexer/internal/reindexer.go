@@ -0,0 +1,259 @@
+package reindexer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// Vectorizer is an interface for generating embeddings from text.
+type Vectorizer interface {
+	VectorizeBatch(texts []string) ([][]byte, error)
+}
+
+// Index is an interface for the operations on an index version.
+type Index interface {
+	Config() store.IndexConfig
+	CreateVectorIndex(ctx context.Context) error
+	ScanArticles(ctx context.Context, fn func([]store.Article) error) error
+	ExistingArticles(ctx context.Context, ids []string) (map[string]time.Time, error)
+	StoreArticles(ctx context.Context, articles []store.Article) error
+	DeleteArticles(ctx context.Context, ids []string) (int, error)
+	ServerTime(ctx context.Context) (time.Time, error)
+	SetVectorizer(ctx context.Context, addr string) error
+	SwapAlias(ctx context.Context) error
+	DropIndex(ctx context.Context) (int, error)
+}
+
+// Options holds the settings of a reindexing.
+type Options struct {
+	// Reembed generates the embeddings of the articles with the vectorizer.
+	// Otherwise the embeddings of the source index are copied, which only
+	// suits changes of the index settings, not of the model.
+	Reembed bool
+	// VectorizerAddr is the address of the vectorizer re-embedding the
+	// articles. It is recorded with the target index, for the clients to
+	// switch to its model along with the alias. The address of the source
+	// index is recorded instead when the embeddings are copied.
+	VectorizerAddr string
+	// BatchSize is the number of articles vectorized at once.
+	BatchSize int
+	// Swap points the alias to the target index once built, and drops the
+	// source index. Otherwise the target index is only built, as the index
+	// of a search variant.
+	Swap bool
+	// SwapGrace is the time left to the clients to follow the swap of the
+	// alias, before the articles stored meanwhile in the source index are
+	// copied and the source index is dropped.
+	SwapGrace time.Duration
+}
+
+// Reindexer builds a new index version from the live one.
+type Reindexer struct {
+	source           Index
+	target           Index
+	vectorizerClient Vectorizer
+	logger           *slog.Logger
+	opts             Options
+}
+
+// New creates a new Reindexer instance, copying the articles of the source
+// index to the target index.
+func New(source, target Index, vectorizerClient Vectorizer, logger *slog.Logger, opts Options) *Reindexer {
+	return &Reindexer{
+		source:           source,
+		target:           target,
+		vectorizerClient: vectorizerClient,
+		logger:           logger,
+		opts:             opts,
+	}
+}
+
+// Run builds the target index, then swaps the alias to it and drops the
+// source index, unless disabled. The search keeps being served by the source index until the swap.
+// Articles already copied are skipped, so an interrupted run may be resumed.
+// Articles updated in the source index since their copy are copied again,
+// and the ones deleted from it are deleted from the target index.
+func (r *Reindexer) Run(ctx context.Context) error {
+	source, target := r.source.Config(), r.target.Config()
+	if target.Version <= source.Version {
+		return fmt.Errorf("target version %d must be greater than the live version %d", target.Version, source.Version)
+	}
+	logger := r.logger.With("source", source.Name(), "target", target.Name())
+
+	if err := r.target.CreateVectorIndex(ctx); err != nil {
+		return fmt.Errorf("failed to create target index: %w", err)
+	}
+	vectorizerAddr := source.VectorizerAddr
+	if r.opts.Reembed {
+		vectorizerAddr = r.opts.VectorizerAddr
+	}
+	// The clients keep their own vectorizer when none is recorded.
+	if vectorizerAddr != "" {
+		if err := r.target.SetVectorizer(ctx, vectorizerAddr); err != nil {
+			return err
+		}
+	}
+	copied, err := r.copyArticles(ctx)
+	if err != nil {
+		return err
+	}
+	logger.Info("Articles copied to the target index", "copied", copied)
+	// Only the clients pinned to the target index write to it before the
+	// swap, and they store the articles as the source clients do.
+	pruneBefore, err := r.target.ServerTime(ctx)
+	if err != nil {
+		return err
+	}
+	deleted, err := r.pruneArticles(ctx, pruneBefore)
+	if err != nil {
+		return err
+	}
+	logger.Info("Articles deleted from the source index pruned", "deleted", deleted)
+	if !r.opts.Swap {
+		logger.Info("Reindexing completed, the alias is left unchanged")
+		return nil
+	}
+
+	// The articles stored in the target index by the clients following the
+	// swap are missing from the source index, but updated after the swap.
+	swappedAt, err := r.target.ServerTime(ctx)
+	if err != nil {
+		return err
+	}
+	if err := r.target.SwapAlias(ctx); err != nil {
+		return err
+	}
+	logger.Info("Alias swapped, waiting for the clients to follow it", "grace", r.opts.SwapGrace)
+	select {
+	case <-time.After(r.opts.SwapGrace):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Articles imported in, or deleted from, the source index during the copy
+	// are caught up.
+	copied, err = r.copyArticles(ctx)
+	if err != nil {
+		return err
+	}
+	deleted, err = r.pruneArticles(ctx, swappedAt)
+	if err != nil {
+		return err
+	}
+	logger.Info("Articles caught up", "copied", copied, "deleted", deleted)
+
+	deleted, err = r.source.DropIndex(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to drop source index: %w", err)
+	}
+	logger.Info("Reindexing completed", "deleted", deleted)
+	return nil
+}
+
+// copyArticles copies the articles of the source index missing from the
+// target index or updated since their copy, and returns the number of copied
+// articles.
+func (r *Reindexer) copyArticles(ctx context.Context) (int, error) {
+	copied := 0
+	err := r.source.ScanArticles(ctx, func(articles []store.Article) error {
+		ids := make([]string, 0, len(articles))
+		for _, article := range articles {
+			ids = append(ids, article.Title)
+		}
+		existing, err := r.target.ExistingArticles(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		missing := make([]store.Article, 0, len(articles))
+		for _, article := range articles {
+			// Copies keep the update time of their source article.
+			if updatedAt, ok := existing[article.Title]; !ok || article.UpdatedAt.After(updatedAt) {
+				missing = append(missing, article)
+			}
+		}
+		for start := 0; start < len(missing); start += r.opts.BatchSize {
+			batch := missing[start:min(start+r.opts.BatchSize, len(missing))]
+			if err := r.copyBatch(ctx, batch); err != nil {
+				return err
+			}
+			copied += len(batch)
+		}
+		r.logger.Debug("Reindexing progress", "copied", copied)
+		return nil
+	})
+	if err != nil {
+		return copied, fmt.Errorf("failed to copy articles: %w", err)
+	}
+	return copied, nil
+}
+
+// pruneArticles deletes the articles of the target index missing from the
+// source index, unless updated since a time, and returns the number of
+// deleted articles.
+func (r *Reindexer) pruneArticles(ctx context.Context, before time.Time) (int, error) {
+	deleted := 0
+	err := r.target.ScanArticles(ctx, func(articles []store.Article) error {
+		ids := make([]string, 0, len(articles))
+		for _, article := range articles {
+			ids = append(ids, article.Title)
+		}
+		existing, err := r.source.ExistingArticles(ctx, ids)
+		if err != nil {
+			return err
+		}
+
+		removed := make([]string, 0, len(articles))
+		for _, article := range articles {
+			if _, ok := existing[article.Title]; !ok && article.UpdatedAt.Before(before) {
+				removed = append(removed, article.Title)
+			}
+		}
+		if len(removed) == 0 {
+			return nil
+		}
+		n, err := r.target.DeleteArticles(ctx, removed)
+		deleted += n
+		return err
+	})
+	if err != nil {
+		return deleted, fmt.Errorf("failed to prune articles: %w", err)
+	}
+	return deleted, nil
+}
+
+// copyBatch stores a batch of articles in the target index, with their new
+// embeddings when reembedding.
+func (r *Reindexer) copyBatch(ctx context.Context, articles []store.Article) error {
+	dimension := r.target.Config().Dimension
+	if r.opts.Reembed {
+		texts := make([]string, 0, len(articles))
+		for _, article := range articles {
+			// Articles stored before their text was kept are embedded from their title.
+			text := article.Text
+			if text == "" {
+				text = article.Title
+			}
+			texts = append(texts, text)
+		}
+		embeddings, err := r.vectorizerClient.VectorizeBatch(texts)
+		if err != nil {
+			return fmt.Errorf("failed to vectorize articles: %w", err)
+		}
+		for i := range articles {
+			articles[i].Embedding = embeddings[i]
+		}
+	}
+
+	for _, article := range articles {
+		// Embeddings are FLOAT32 at this point.
+		if len(article.Embedding) != dimension*4 {
+			return fmt.Errorf("embedding of article %s has dimension %d, the target index expects %d", article.Title, len(article.Embedding)/4, dimension)
+		}
+	}
+	return r.target.StoreArticles(ctx, articles)
+}
@@ -0,0 +1,391 @@
+package reindexer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// mockVectorizer implements the Vectorizer interface for testing.
+type mockVectorizer struct {
+	texts []string
+	err   error
+}
+
+func (m *mockVectorizer) VectorizeBatch(texts []string) ([][]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.texts = append(m.texts, texts...)
+	embeddings := make([][]byte, len(texts))
+	for i := range texts {
+		embeddings[i] = make([]byte, testDimension*4)
+		embeddings[i][0] = 1
+	}
+	return embeddings, nil
+}
+
+const testDimension = 4
+
+// mockIndex implements the Index interface for testing.
+type mockIndex struct {
+	config   store.IndexConfig
+	articles []store.Article
+	swapped  bool
+	dropped  bool
+	storeErr error
+	events   *[]string
+	// afterBatch is called after each scanned batch.
+	afterBatch func()
+}
+
+func (m *mockIndex) Config() store.IndexConfig {
+	return m.config
+}
+
+func (m *mockIndex) CreateVectorIndex(ctx context.Context) error {
+	*m.events = append(*m.events, "create "+m.config.Name())
+	return nil
+}
+
+func (m *mockIndex) ScanArticles(ctx context.Context, fn func([]store.Article) error) error {
+	// Articles are scanned by batches of two, from the articles stored when
+	// the scan started.
+	articles := slices.Clone(m.articles)
+	for start := 0; start < len(articles); start += 2 {
+		batch := append([]store.Article(nil), articles[start:min(start+2, len(articles))]...)
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if m.afterBatch != nil {
+			m.afterBatch()
+		}
+	}
+	return nil
+}
+
+func (m *mockIndex) ExistingArticles(ctx context.Context, ids []string) (map[string]time.Time, error) {
+	existing := make(map[string]time.Time)
+	for _, article := range m.articles {
+		if slices.Contains(ids, article.Title) {
+			existing[article.Title] = article.UpdatedAt
+		}
+	}
+	return existing, nil
+}
+
+func (m *mockIndex) StoreArticles(ctx context.Context, articles []store.Article) error {
+	if m.storeErr != nil {
+		return m.storeErr
+	}
+	for _, article := range articles {
+		if article.UpdatedAt.IsZero() {
+			article.UpdatedAt = time.Now()
+		}
+		if i := slices.IndexFunc(m.articles, func(a store.Article) bool { return a.Title == article.Title }); i >= 0 {
+			m.articles[i] = article
+		} else {
+			m.articles = append(m.articles, article)
+		}
+	}
+	return nil
+}
+
+func (m *mockIndex) DeleteArticles(ctx context.Context, ids []string) (int, error) {
+	n := len(m.articles)
+	m.articles = slices.DeleteFunc(m.articles, func(a store.Article) bool { return slices.Contains(ids, a.Title) })
+	return n - len(m.articles), nil
+}
+
+func (m *mockIndex) ServerTime(ctx context.Context) (time.Time, error) {
+	return time.Now(), nil
+}
+
+func (m *mockIndex) SetVectorizer(ctx context.Context, addr string) error {
+	*m.events = append(*m.events, "vectorizer "+addr)
+	return nil
+}
+
+func (m *mockIndex) SwapAlias(ctx context.Context) error {
+	*m.events = append(*m.events, "swap "+m.config.Name())
+	m.swapped = true
+	return nil
+}
+
+func (m *mockIndex) DropIndex(ctx context.Context) (int, error) {
+	*m.events = append(*m.events, "drop "+m.config.Name())
+	m.dropped = true
+	return len(m.articles), nil
+}
+
+func TestRun(t *testing.T) {
+	sourceEmbedding := make([]byte, testDimension*4)
+	testCases := []struct {
+		name           string
+		targetVersion  int
+		reembed        bool
+		sourceArticles []store.Article
+		targetArticles []store.Article
+		storeErr       error
+		vectorizerErr  error
+		expectError    string
+		expectedTexts  []string
+		expectedTitles []string
+	}{
+		{
+			name:          "Reembed",
+			targetVersion: 2,
+			reembed:       true,
+			sourceArticles: []store.Article{
+				{Title: "A", Text: "A. Description", Embedding: sourceEmbedding},
+				{Title: "B", Embedding: sourceEmbedding},
+				{Title: "C", Text: "C. Description", Embedding: sourceEmbedding},
+			},
+			expectedTexts:  []string{"A. Description", "B", "C. Description"},
+			expectedTitles: []string{"A", "B", "C"},
+		},
+		{
+			name:          "CopyEmbeddings",
+			targetVersion: 2,
+			sourceArticles: []store.Article{
+				{Title: "A", Embedding: sourceEmbedding},
+			},
+			expectedTitles: []string{"A"},
+		},
+		{
+			name:          "ResumeSkipsCopiedArticles",
+			targetVersion: 3,
+			reembed:       true,
+			sourceArticles: []store.Article{
+				{Title: "A", Text: "A. Description", Embedding: sourceEmbedding},
+				{Title: "B", Text: "B. Description", Embedding: sourceEmbedding},
+			},
+			targetArticles: []store.Article{
+				{Title: "A", Embedding: sourceEmbedding},
+			},
+			expectedTexts:  []string{"B. Description"},
+			expectedTitles: []string{"A", "B"},
+		},
+		{
+			name:          "TargetVersionNotGreater",
+			targetVersion: 1,
+			expectError:   "must be greater than the live version",
+		},
+		{
+			name:          "DimensionMismatch",
+			targetVersion: 2,
+			sourceArticles: []store.Article{
+				{Title: "A", Embedding: make([]byte, 8)},
+			},
+			expectError: "the target index expects 4",
+		},
+		{
+			name:          "VectorizerError",
+			targetVersion: 2,
+			reembed:       true,
+			sourceArticles: []store.Article{
+				{Title: "A", Embedding: sourceEmbedding},
+			},
+			vectorizerErr: errors.New("vectorizer down"),
+			expectError:   "failed to vectorize articles",
+		},
+		{
+			name:          "StoreError",
+			targetVersion: 2,
+			sourceArticles: []store.Article{
+				{Title: "A", Embedding: sourceEmbedding},
+			},
+			storeErr:    errors.New("redis down"),
+			expectError: "redis down",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []string
+			source := &mockIndex{
+				config:   store.IndexConfig{Version: 1, Dimension: testDimension},
+				articles: tc.sourceArticles,
+				events:   &events,
+			}
+			target := &mockIndex{
+				config:   store.IndexConfig{Version: tc.targetVersion, Dimension: testDimension},
+				articles: tc.targetArticles,
+				storeErr: tc.storeErr,
+				events:   &events,
+			}
+			vectorizer := &mockVectorizer{err: tc.vectorizerErr}
+			r := New(source, target, vectorizer, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+				Reembed:   tc.reembed,
+				BatchSize: 2,
+				Swap:      true,
+			})
+
+			err := r.Run(context.Background())
+			if tc.expectError != "" {
+				require.ErrorContains(t, err, tc.expectError)
+				assert.False(t, target.swapped, "alias must not be swapped on failure")
+				assert.False(t, source.dropped, "source must not be dropped on failure")
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"create " + target.config.Name(), "swap " + target.config.Name(), "drop gs_data"}, events)
+			assert.Equal(t, tc.expectedTexts, vectorizer.texts)
+			var titles []string
+			for _, article := range target.articles {
+				titles = append(titles, article.Title)
+				assert.Len(t, article.Embedding, testDimension*4)
+			}
+			assert.Equal(t, tc.expectedTitles, titles)
+		})
+	}
+}
+
+func TestRunCatchesUpArticlesImportedDuringCopy(t *testing.T) {
+	var events []string
+	embedding := make([]byte, testDimension*4)
+	source := &mockIndex{
+		config:   store.IndexConfig{Version: 1, Dimension: testDimension},
+		articles: []store.Article{{Title: "A", Embedding: embedding}},
+		events:   &events,
+	}
+	target := &swapHookIndex{
+		mockIndex: mockIndex{config: store.IndexConfig{Version: 2, Dimension: testDimension}, events: &events},
+		onSwap: func() {
+			source.articles = append(source.articles, store.Article{Title: "B", Embedding: embedding})
+		},
+	}
+	r := New(source, target, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{BatchSize: 10, Swap: true})
+
+	require.NoError(t, r.Run(context.Background()))
+	require.Len(t, target.articles, 2)
+	assert.Equal(t, "B", target.articles[1].Title)
+}
+
+func TestRunSyncsArticlesChangedDuringCopy(t *testing.T) {
+	var events []string
+	embedding := make([]byte, testDimension*4)
+	copiedAt := time.Now().Add(-time.Hour)
+	source := &mockIndex{
+		config: store.IndexConfig{Version: 1, Dimension: testDimension},
+		articles: []store.Article{
+			{Title: "A", Embedding: embedding, UpdatedAt: copiedAt},
+			{Title: "B", Text: "B. Updated", Embedding: embedding, UpdatedAt: copiedAt.Add(time.Minute)},
+			{Title: "C", Embedding: embedding, UpdatedAt: copiedAt},
+		},
+		events: &events,
+	}
+	// A is deleted from the source index once copied.
+	source.afterBatch = func() {
+		source.articles = slices.DeleteFunc(source.articles, func(a store.Article) bool { return a.Title == "A" })
+		source.afterBatch = nil
+	}
+	target := &mockIndex{
+		config: store.IndexConfig{Version: 2, Dimension: testDimension},
+		articles: []store.Article{
+			{Title: "B", Text: "B", Embedding: embedding, UpdatedAt: copiedAt},
+			{Title: "D", Embedding: embedding, UpdatedAt: copiedAt},
+		},
+		events: &events,
+	}
+	r := New(source, target, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{BatchSize: 10})
+
+	require.NoError(t, r.Run(context.Background()))
+	texts := make(map[string]string)
+	for _, article := range target.articles {
+		texts[article.Title] = article.Text
+	}
+	assert.Equal(t, map[string]string{"B": "B. Updated", "C": ""}, texts)
+}
+
+func TestRunCatchesUpArticlesDeletedDuringGrace(t *testing.T) {
+	var events []string
+	embedding := make([]byte, testDimension*4)
+	source := &mockIndex{
+		config:   store.IndexConfig{Version: 1, Dimension: testDimension},
+		articles: []store.Article{{Title: "A", Embedding: embedding}, {Title: "B", Embedding: embedding}},
+		events:   &events,
+	}
+	target := &swapHookIndex{mockIndex: mockIndex{config: store.IndexConfig{Version: 2, Dimension: testDimension}, events: &events}}
+	target.onSwap = func() {
+		// A is deleted by a client still on the source index, and C is
+		// imported by a client following the swap.
+		source.articles = source.articles[1:]
+		target.articles = append(target.articles, store.Article{Title: "C", Embedding: embedding, UpdatedAt: time.Now()})
+	}
+	r := New(source, target, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{BatchSize: 10, Swap: true})
+
+	require.NoError(t, r.Run(context.Background()))
+	var titles []string
+	for _, article := range target.articles {
+		titles = append(titles, article.Title)
+	}
+	assert.Equal(t, []string{"B", "C"}, titles)
+}
+
+// swapHookIndex calls onSwap when the alias is swapped to it.
+type swapHookIndex struct {
+	mockIndex
+	onSwap func()
+}
+
+func (m *swapHookIndex) SwapAlias(ctx context.Context) error {
+	m.onSwap()
+	return m.mockIndex.SwapAlias(ctx)
+}
+
+func TestRunWithoutSwap(t *testing.T) {
+	var events []string
+	source := &mockIndex{
+		config:   store.IndexConfig{Version: 1, Dimension: testDimension},
+		articles: []store.Article{{Title: "A", Text: "A. Description"}},
+		events:   &events,
+	}
+	target := &mockIndex{config: store.IndexConfig{Version: 2, Dimension: testDimension}, events: &events}
+	r := New(source, target, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{Reembed: true, BatchSize: 10})
+
+	require.NoError(t, r.Run(context.Background()))
+	assert.Equal(t, []string{"create gs_data_v2"}, events)
+	assert.Len(t, target.articles, 1)
+	assert.False(t, source.dropped)
+}
+
+func TestRunRecordsVectorizer(t *testing.T) {
+	embedding := make([]byte, testDimension*4)
+	for _, tc := range []struct {
+		name     string
+		reembed  bool
+		expected []string
+	}{
+		{name: "Reembed", reembed: true, expected: []string{"create gs_data_v2", "vectorizer http://vectorizer-v2:8080", "swap gs_data_v2", "drop gs_data"}},
+		{name: "Copy", expected: []string{"create gs_data_v2", "vectorizer http://vectorizer:8080", "swap gs_data_v2", "drop gs_data"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []string
+			source := &mockIndex{
+				config:   store.IndexConfig{Version: 1, Dimension: testDimension, VectorizerAddr: "http://vectorizer:8080"},
+				articles: []store.Article{{Title: "A", Text: "A. Description", Embedding: embedding}},
+				events:   &events,
+			}
+			target := &mockIndex{config: store.IndexConfig{Version: 2, Dimension: testDimension}, events: &events}
+			r := New(source, target, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+				Reembed:        tc.reembed,
+				VectorizerAddr: "http://vectorizer-v2:8080",
+				BatchSize:      10,
+				Swap:           true,
+			})
+
+			require.NoError(t, r.Run(context.Background()))
+			assert.Equal(t, tc.expected, events)
+		})
+	}
+}
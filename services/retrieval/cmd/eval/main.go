@@ -0,0 +1,152 @@
+// Command eval measures the relevance of the retrieval service against judged
+// queries, and compares runs.
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/segmentio/encoding/json"
+	"github.com/turanic/gs_search/pkg/store"
+	"github.com/turanic/gs_search/pkg/vectorization"
+	retrieval "github.com/turanic/gs_search/services/retrieval/internal"
+	"github.com/turanic/gs_search/services/retrieval/internal/eval"
+)
+
+// Config holds the configuration of the search stack, as for the retrieval service.
+type Config struct {
+	RedisAddr          string            `envconfig:"REDIS_ADDR"`
+	RedisPassword      string            `envconfig:"REDIS_PASSWORD"`
+	VectorizerAddr     string            `envconfig:"VECTORIZER_ADDR"`
+	EmbeddingDimension int               `envconfig:"EMBEDDING_DIMENSION" default:"384"`
+	Index              store.IndexConfig `envconfig:"INDEX"`
+}
+
+// searcher runs the judged queries through the retrieval search.
+type searcher struct {
+	server *retrieval.Server
+}
+
+func (s *searcher) Search(ctx context.Context, query, site string, k int) ([]string, error) {
+	response, err := s.server.Search(ctx, retrieval.SearchRequest{Query: query, Site: site, Limit: k})
+	if err != nil {
+		return nil, err
+	}
+	links := make([]string, 0, len(response.Results))
+	for _, result := range response.Results {
+		links = append(links, result.URL)
+	}
+	return links, nil
+}
+
+func main() {
+	queriesPath := flag.String("queries", "services/retrieval/cmd/eval/queries.example.jsonl", "JSONL file of the judged queries")
+	k := flag.Int("k", 10, "number of results evaluated per query, up to 100")
+	label := flag.String("label", "", "label of the run in the report")
+	format := flag.String("format", "table", "output format, table or json")
+	outPath := flag.String("out", "", "file to write the JSON report to, to compare a later run with")
+	baselinePath := flag.String("baseline", "", "JSON report of a previous run to compare with")
+	indexVersion := flag.Int("index-version", 0, "index version to search rather than the live one")
+	flag.Parse()
+
+	var config Config
+	if err := envconfig.Process("", &config); err != nil {
+		log.Fatalf("Failed to process config: %v", err)
+	}
+	config.Index.Dimension = config.EmbeddingDimension
+	if err := config.Index.Validate(); err != nil {
+		log.Fatalf("Invalid index config: %v", err)
+	}
+
+	judgments, err := readJudgments(*queriesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	redisClient := store.New(config.RedisAddr, config.RedisPassword, config.Index)
+	defer redisClient.Close()
+	var articleStore retrieval.Store = redisClient
+	if *indexVersion > 0 {
+		index := config.Index
+		index.Version = *indexVersion
+		articleStore = redisClient.WithIndex(index)
+	}
+
+	logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+	server, err := retrieval.New("", articleStore, vectorization.New(config.VectorizerAddr), logger, retrieval.Options{})
+	if err != nil {
+		log.Fatalf("Failed to initialize retrieval: %v", err)
+	}
+
+	report, err := eval.Run(context.Background(), &searcher{server: server}, judgments, *k, *label)
+	if err != nil {
+		log.Fatalf("Evaluation failed: %v", err)
+	}
+	if *outPath != "" {
+		if err := writeJSONFile(*outPath, report); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var comparison *eval.Comparison
+	if *baselinePath != "" {
+		baseline, err := readReport(*baselinePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		comparison = eval.Compare(baseline, report)
+	}
+
+	if *format == "json" {
+		output := struct {
+			Report     *eval.Report     `json:"report"`
+			Comparison *eval.Comparison `json:"comparison,omitempty"`
+		}{report, comparison}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(output)
+	} else {
+		err = eval.WriteTable(os.Stdout, report)
+		if err == nil && comparison != nil {
+			os.Stdout.WriteString("\nCompared to " + *baselinePath + ":\n")
+			err = eval.WriteComparisonTable(os.Stdout, comparison)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+}
+
+func readJudgments(path string) ([]eval.Judgment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return eval.ReadJudgments(f)
+}
+
+func readReport(path string) (*eval.Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report eval.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
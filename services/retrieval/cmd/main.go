@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"github.com/turanic/gs_search/pkg/store"
@@ -16,12 +18,69 @@ import (
 
 // Config holds the configuration for the retrieval service.
 type Config struct {
-	RedisAddr          string `envconfig:"REDIS_ADDR"`
-	RedisPassword      string `envconfig:"REDIS_PASSWORD"`
-	ServerPort         string `envconfig:"SERVER_PORT" default:"8080"`
-	VectorizerAddr     string `envconfig:"VECTORIZER_ADDR"`
-	DebugMode          bool   `envconfig:"DEBUG_MODE" default:"false"`
-	EmbeddingDimension int    `envconfig:"EMBEDDING_DIMENSION" default:"384"`
+	RedisAddr     string `envconfig:"REDIS_ADDR"`
+	RedisPassword string `envconfig:"REDIS_PASSWORD"`
+	ServerPort    string `envconfig:"SERVER_PORT" default:"8080"`
+	// HTTP server settings. The API is served over TLS when the certificate
+	// and key files are set, reloaded on SIGHUP, and HTTP/2 is served without
+	// TLS with H2C_ENABLED.
+	BindAddress string `envconfig:"BIND_ADDRESS"`
+	// The timeouts and the maximum header size default to the ones of
+	// retrieval.HTTPConfig when unset.
+	ReadTimeout        time.Duration `envconfig:"READ_TIMEOUT"`
+	WriteTimeout       time.Duration `envconfig:"WRITE_TIMEOUT"`
+	IdleTimeout        time.Duration `envconfig:"IDLE_TIMEOUT"`
+	MaxHeaderBytes     int           `envconfig:"MAX_HEADER_BYTES"`
+	TLSCertFile        string        `envconfig:"TLS_CERT_FILE"`
+	TLSKeyFile         string        `envconfig:"TLS_KEY_FILE"`
+	H2CEnabled         bool          `envconfig:"H2C_ENABLED" default:"false"`
+	VectorizerAddr     string        `envconfig:"VECTORIZER_ADDR"`
+	DebugMode          bool          `envconfig:"DEBUG_MODE" default:"false"`
+	EmbeddingDimension int           `envconfig:"EMBEDDING_DIMENSION" default:"384"`
+	AdminToken         string        `envconfig:"ADMIN_TOKEN"`
+	// AnalyticsEnabled logs the searches and the feedback to Redis streams.
+	AnalyticsEnabled bool `envconfig:"ANALYTICS_ENABLED" default:"true"`
+	// Reranker reorders the nearest neighbours of the queries when its address is set.
+	RerankerAddr     string        `envconfig:"RERANKER_ADDR"`
+	RerankCandidates int           `envconfig:"RERANK_CANDIDATES" default:"50"`
+	RerankTimeout    time.Duration `envconfig:"RERANK_TIMEOUT" default:"300ms"`
+	// Recency ranks the recent articles higher when its weight is positive.
+	RecencyWeight   float64       `envconfig:"RECENCY_WEIGHT" default:"0"`
+	RecencyHalfLife time.Duration `envconfig:"RECENCY_HALF_LIFE" default:"720h"`
+	// Index holds the vector index settings, read from the INDEX_ variables.
+	Index store.IndexConfig `envconfig:"INDEX"`
+	// Collections are the named collections searchable besides the default
+	// one, with the API keys granting access to them as
+	// key:collection|collection pairs.
+	Collections []string          `envconfig:"COLLECTIONS"`
+	APIKeys     map[string]string `envconfig:"API_KEYS"`
+	// RequireAPIKey rejects the API requests without a valid API key.
+	RequireAPIKey bool `envconfig:"REQUIRE_API_KEY" default:"false"`
+	// Rate limits of the API requests per API key and per IP address,
+	// disabled when zero. They are shared by the replicas through Redis.
+	KeyRateLimit   float64 `envconfig:"RATE_LIMIT_KEY_RPS" default:"0"`
+	KeyRateBurst   int     `envconfig:"RATE_LIMIT_KEY_BURST" default:"20"`
+	IPRateLimit    float64 `envconfig:"RATE_LIMIT_IP_RPS" default:"0"`
+	IPRateBurst    int     `envconfig:"RATE_LIMIT_IP_BURST" default:"10"`
+	ClientIPHeader string  `envconfig:"CLIENT_IP_HEADER"`
+	// Admission bounds the vectorizer calls in flight, the calls beyond the
+	// queue or waiting longer than its maximum wait being shed with a 503.
+	// It is disabled when the maximum is zero.
+	VectorizerMaxConcurrent int           `envconfig:"VECTORIZER_MAX_CONCURRENT" default:"4"`
+	VectorizerMaxQueue      int           `envconfig:"VECTORIZER_MAX_QUEUE" default:"16"`
+	VectorizerMaxQueueWait  time.Duration `envconfig:"VECTORIZER_MAX_QUEUE_WAIT" default:"250ms"`
+	// The circuit of a vectorizer opens after consecutive failures, the
+	// searches falling back to a text search of the titles until it recovers.
+	// The circuit breaker is disabled when the threshold is zero.
+	VectorizerFailureThreshold int           `envconfig:"VECTORIZER_FAILURE_THRESHOLD" default:"5"`
+	VectorizerOpenTimeout      time.Duration `envconfig:"VECTORIZER_OPEN_TIMEOUT" default:"30s"`
+	// Variant is searched by a share of the queries when its vectorizer is set.
+	// Its index is pinned to a version, read from the VARIANT_INDEX_ variables.
+	VariantName               string            `envconfig:"VARIANT_NAME" default:"variant"`
+	VariantVectorizerAddr     string            `envconfig:"VARIANT_VECTORIZER_ADDR"`
+	VariantEmbeddingDimension int               `envconfig:"VARIANT_EMBEDDING_DIMENSION" default:"384"`
+	VariantPercent            int               `envconfig:"VARIANT_PERCENT" default:"0"`
+	VariantIndex              store.IndexConfig `envconfig:"VARIANT_INDEX"`
 }
 
 func main() {
@@ -39,7 +98,12 @@ func main() {
 	})
 	logger := slog.New(handler).With("service", "retrieval")
 
-	redisClient := store.New(config.RedisAddr, config.RedisPassword, config.EmbeddingDimension)
+	config.Index.Dimension = config.EmbeddingDimension
+	if err := config.Index.Validate(); err != nil {
+		log.Fatalf("Invalid index config: %v", err)
+	}
+
+	redisClient := store.New(config.RedisAddr, config.RedisPassword, config.Index)
 	if err := redisClient.Ping(context.Background()); err != nil {
 		logger.Error("Failed to connect to Redis", "error", err)
 		log.Fatalf("Failed to connect to Redis: %v", err)
@@ -50,7 +114,95 @@ func main() {
 		logger.Warn("Vectorizer health check failed", "error", err)
 	}
 
-	srv, err := retrieval.New(config.ServerPort, redisClient, vectorizerClient, logger)
+	var variants []retrieval.Variant
+	if config.VariantVectorizerAddr != "" {
+		config.VariantIndex.Dimension = config.VariantEmbeddingDimension
+		if err := config.VariantIndex.Validate(); err != nil {
+			log.Fatalf("Invalid variant index config: %v", err)
+		}
+		variantVectorizer := vectorization.New(config.VariantVectorizerAddr)
+		if err := variantVectorizer.HealthCheck(); err != nil {
+			logger.Warn("Variant vectorizer health check failed", "error", err)
+		}
+		variants = append(variants, retrieval.Variant{
+			Name:       config.VariantName,
+			Vectorizer: variantVectorizer,
+			Store:      redisClient.WithIndex(config.VariantIndex),
+			Percent:    config.VariantPercent,
+		})
+		logger.Info("Variant enabled", "variant", config.VariantName, "index", config.VariantIndex.Name(), "percent", config.VariantPercent)
+	}
+
+	collections := make(map[string]retrieval.Store, len(config.Collections))
+	versions := indexVersions{clients: map[string]*store.Client{"": redisClient}}
+	for _, name := range config.Collections {
+		if err := store.ValidateCollection(name); err != nil {
+			log.Fatalf("Invalid collection: %v", err)
+		}
+		collectionClient := redisClient.WithCollection(name)
+		collections[name] = collectionClient
+		versions.clients[name] = collectionClient
+	}
+	apiKeys := make(map[string][]string, len(config.APIKeys))
+	for key, names := range config.APIKeys {
+		// Keys may grant access to no named collection, for authentication
+		// and rate limiting only.
+		apiKeys[key] = strings.FieldsFunc(names, func(r rune) bool { return r == '|' })
+	}
+	if len(collections) > 0 {
+		logger.Info("Collections enabled", "collections", config.Collections, "api_keys", len(apiKeys))
+	}
+
+	opts := retrieval.Options{
+		HTTP: retrieval.HTTPConfig{
+			BindAddress:    config.BindAddress,
+			ReadTimeout:    config.ReadTimeout,
+			WriteTimeout:   config.WriteTimeout,
+			IdleTimeout:    config.IdleTimeout,
+			MaxHeaderBytes: config.MaxHeaderBytes,
+			TLSCertFile:    config.TLSCertFile,
+			TLSKeyFile:     config.TLSKeyFile,
+			H2C:            config.H2CEnabled,
+		},
+		AdminToken:     config.AdminToken,
+		Variants:       variants,
+		Collections:    collections,
+		IndexVersions:  versions,
+		APIKeys:        apiKeys,
+		RequireAPIKey:  config.RequireAPIKey,
+		KeyRateLimit:   retrieval.RateLimit{PerSecond: config.KeyRateLimit, Burst: config.KeyRateBurst},
+		IPRateLimit:    retrieval.RateLimit{PerSecond: config.IPRateLimit, Burst: config.IPRateBurst},
+		ClientIPHeader: config.ClientIPHeader,
+		Admission: retrieval.Admission{
+			MaxConcurrent: config.VectorizerMaxConcurrent,
+			MaxQueue:      config.VectorizerMaxQueue,
+			MaxQueueWait:  config.VectorizerMaxQueueWait,
+		},
+		CircuitBreaker: retrieval.CircuitBreaker{
+			FailureThreshold: config.VectorizerFailureThreshold,
+			OpenTimeout:      config.VectorizerOpenTimeout,
+		},
+		RecencyWeight:   config.RecencyWeight,
+		RecencyHalfLife: config.RecencyHalfLife,
+	}
+	if config.AnalyticsEnabled {
+		opts.Events = redisClient
+	}
+	if config.KeyRateLimit > 0 || config.IPRateLimit > 0 {
+		opts.RateLimiter = redisClient
+		logger.Info("Rate limiting enabled", "key_rps", config.KeyRateLimit, "key_burst", config.KeyRateBurst, "ip_rps", config.IPRateLimit, "ip_burst", config.IPRateBurst)
+	}
+	if config.RerankerAddr != "" {
+		reranker := vectorization.New(config.RerankerAddr)
+		if err := reranker.HealthCheck(); err != nil {
+			logger.Warn("Reranker health check failed", "error", err)
+		}
+		opts.Reranker = reranker
+		opts.RerankCandidates = config.RerankCandidates
+		opts.RerankTimeout = config.RerankTimeout
+		logger.Info("Reranking enabled", "candidates", config.RerankCandidates, "timeout", config.RerankTimeout)
+	}
+	srv, err := retrieval.New(config.ServerPort, redisClient, vectorizerClient, logger, opts)
 	if err != nil {
 		log.Fatalf("Failed to initialize retrieval service: %v", err)
 	}
@@ -61,6 +213,19 @@ func main() {
 		}
 	}()
 
+	// Reload the TLS certificate on SIGHUP, for its renewals.
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			if err := srv.ReloadCertificate(); err != nil {
+				logger.Error("Failed to reload TLS certificate", "error", err)
+				continue
+			}
+			logger.Info("TLS certificate reloaded", "cert_file", config.TLSCertFile)
+		}
+	}()
+
 	// Setup graceful shutdown.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -69,3 +234,17 @@ func main() {
 	srv.Shutdown()
 	logger.Info("Retrieval service stopped")
 }
+
+// indexVersions resolves the live index versions of the collections.
+type indexVersions struct {
+	clients map[string]*store.Client
+}
+
+func (v indexVersions) ResolveVersion(ctx context.Context, collection string) (retrieval.Store, string) {
+	live := v.clients[collection].Resolved(ctx)
+	return live, live.Config().VectorizerAddr
+}
+
+func (v indexVersions) NewVectorizer(addr string) retrieval.Vectorizer {
+	return vectorization.New(addr)
+}
@@ -0,0 +1,207 @@
+package retrieval
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// requireAdmin restricts the handler to the callers providing the admin token.
+// The IP address is charged before the token is validated, as requireAPIAccess
+// does for the API keys, so that it cannot be guessed faster than its limit.
+func (s *Server) requireAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket := rateLimitBucket{name: "ip:" + s.clientIP(r), limit: s.opts.IPRateLimit}
+		if apiErr := s.takeBucketTokens(r, bucket, 1); apiErr != nil {
+			s.writeError(w, r, apiErr)
+			return
+		}
+		if !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			s.writeError(w, r, newAPIError(CodeUnauthorized, "Missing or invalid admin token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// isAdmin reports whether the request carries the admin token.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.opts.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.opts.AdminToken)) == 1
+}
+
+// ArticleResponse represents a stored article.
+type ArticleResponse struct {
+	ID                 string     `json:"id"`
+	Title              string     `json:"title"`
+	URL                string     `json:"url"`
+	Site               string     `json:"site"`
+	PublishedAt        *time.Time `json:"published_at,omitempty"`
+	EmbeddingDimension int        `json:"embedding_dimension"`
+}
+
+func newArticleResponse(article *store.Article) ArticleResponse {
+	response := ArticleResponse{
+		ID:    article.Title,
+		Title: article.Title,
+		URL:   article.Link,
+		Site:  article.Site,
+		// Embeddings are stored as FLOAT32.
+		EmbeddingDimension: len(article.Embedding) / 4,
+	}
+	if !article.PublishedAt.IsZero() {
+		response.PublishedAt = &article.PublishedAt
+	}
+	return response
+}
+
+// handleGetArticle handles the GET /admin/articles/{id} endpoint.
+func (s *Server) handleGetArticle(w http.ResponseWriter, r *http.Request) {
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	id := r.PathValue("id")
+	article, err := articleStore.GetArticle(r.Context(), id)
+	if errors.Is(err, store.ErrArticleNotFound) {
+		s.writeError(w, r, newAPIError(CodeArticleNotFound, fmt.Sprintf("Article %q not found", id)))
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to get article", "error", err, "id", id, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to get article"))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, newArticleResponse(article))
+}
+
+// handleDeleteArticle handles the DELETE /admin/articles/{id} endpoint.
+func (s *Server) handleDeleteArticle(w http.ResponseWriter, r *http.Request) {
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	id := r.PathValue("id")
+	err := articleStore.DeleteArticle(r.Context(), id)
+	if errors.Is(err, store.ErrArticleNotFound) {
+		s.writeError(w, r, newAPIError(CodeArticleNotFound, fmt.Sprintf("Article %q not found", id)))
+		return
+	}
+	if err != nil {
+		s.logger.Error("Failed to delete article", "error", err, "id", id, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to delete article"))
+		return
+	}
+	s.logger.Info("Article deleted", "id", id, "request_id", requestID(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteResponse represents the result of a bulk deletion.
+type DeleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// handleDeleteSiteArticles handles the DELETE /admin/articles?site= endpoint.
+func (s *Server) handleDeleteSiteArticles(w http.ResponseWriter, r *http.Request) {
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	site := r.URL.Query().Get("site")
+	if site == "" {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, "Site cannot be empty"))
+		return
+	}
+
+	deleted, err := articleStore.DeleteSiteArticles(r.Context(), site)
+	if err != nil {
+		s.logger.Error("Failed to delete site articles", "error", err, "site", site, "deleted", deleted, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to delete site articles"))
+		return
+	}
+	s.logger.Info("Site articles deleted", "site", site, "deleted", deleted, "request_id", requestID(r))
+	s.writeJSON(w, http.StatusOK, DeleteResponse{Deleted: deleted})
+}
+
+// UpsertArticleRequest represents an article to create or replace.
+type UpsertArticleRequest struct {
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Site        string     `json:"site,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// Text is the text embedded for the article. The title is used when empty.
+	Text string `json:"text,omitempty"`
+}
+
+// handleUpsertArticle handles the POST /admin/articles endpoint. The article
+// text is embedded by the vectorizer of the live index version before being
+// stored in it.
+func (s *Server) handleUpsertArticle(w http.ResponseWriter, r *http.Request) {
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	live := s.liveVariant(r.Context(), r.URL.Query().Get("collection"), articleStore)
+
+	var req UpsertArticleRequest
+	if apiErr := decodeRequest(w, r, &req); apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	if req.Title == "" || req.URL == "" {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, "Title and url are required"))
+		return
+	}
+
+	text := req.Text
+	if strings.TrimSpace(text) == "" {
+		text = req.Title
+	}
+	release, err := s.admission.admit(r.Context())
+	if err != nil {
+		s.logger.Warn("Article embedding not admitted", "error", err, "request_id", requestID(r))
+		s.writeError(w, r, admissionError(err))
+		return
+	}
+	embedding, err := live.Vectorizer.Vectorize(text)
+	release()
+	if err != nil {
+		s.logger.Error("Failed to generate article embedding", "error", err, "id", req.Title, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeEmbeddingUnavailable, "Failed to generate article embedding"))
+		return
+	}
+
+	article := store.Article{
+		Title:     req.Title,
+		Link:      req.URL,
+		Site:      req.Site,
+		Text:      text,
+		Embedding: embedding,
+	}
+	if article.Site == "" {
+		article.Site = store.SiteFromURL(req.URL)
+	}
+	if req.PublishedAt != nil {
+		article.PublishedAt = *req.PublishedAt
+	}
+	if err := live.Store.StoreArticles(r.Context(), []store.Article{article}); err != nil {
+		s.logger.Error("Failed to store article", "error", err, "id", req.Title, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to store article"))
+		return
+	}
+	s.logger.Info("Article upserted", "id", req.Title, "request_id", requestID(r))
+	s.writeJSON(w, http.StatusOK, newArticleResponse(&article))
+}
@@ -0,0 +1,184 @@
+package retrieval
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	testCases := []struct {
+		name           string
+		adminToken     string
+		authorization  string
+		limiter        *mockRateLimiter
+		expectedStatus int
+	}{
+		{name: "ValidToken", adminToken: "secret", authorization: "Bearer secret", expectedStatus: http.StatusNoContent},
+		{name: "InvalidToken", adminToken: "secret", authorization: "Bearer guess", expectedStatus: http.StatusUnauthorized},
+		{name: "MissingToken", adminToken: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "WrongScheme", adminToken: "secret", authorization: "Basic secret", expectedStatus: http.StatusUnauthorized},
+		{name: "AdminDisabled", authorization: "Bearer ", expectedStatus: http.StatusUnauthorized},
+		{name: "GuessesRateLimited", adminToken: "secret", authorization: "Bearer guess", limiter: &mockRateLimiter{}, expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:  &mockStore{},
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts:   Options{AdminToken: tc.adminToken},
+			}
+			if tc.limiter != nil {
+				server.opts.RateLimiter = tc.limiter
+				server.opts.IPRateLimit = RateLimit{PerSecond: 1, Burst: 2}
+			}
+
+			req := httptest.NewRequest(http.MethodDelete, "/admin/articles/some%20title", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="admin"`, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAdminArticles(t *testing.T) {
+	publishedAt := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+	storedArticle := store.Article{
+		Title:       "Macron annonce",
+		Link:        "https://www.vsd.fr/macron-annonce",
+		Site:        "vsd.fr",
+		PublishedAt: publishedAt,
+		Text:        "Macron annonce. Une description.",
+		Embedding:   make([]byte, 384*4),
+	}
+
+	testCases := []struct {
+		name             string
+		method           string
+		url              string
+		body             string
+		mockStore        *mockStore
+		mockVectorizer   *mockVectorizer
+		expectedStatus   int
+		expectedContains string
+		expectedStored   []store.Article
+	}{
+		{
+			name:             "GetArticle",
+			method:           http.MethodGet,
+			url:              "/admin/articles/Macron%20annonce",
+			mockStore:        &mockStore{storedArticles: []store.Article{storedArticle}},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"embedding_dimension":384`,
+		},
+		{
+			name:           "GetUnknownArticle",
+			method:         http.MethodGet,
+			url:            "/admin/articles/unknown",
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "DeleteArticle",
+			method:         http.MethodDelete,
+			url:            "/admin/articles/Macron%20annonce",
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "DeleteUnknownArticle",
+			method:         http.MethodDelete,
+			url:            "/admin/articles/unknown",
+			mockStore:      &mockStore{storeErr: store.ErrArticleNotFound},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:             "DeleteSiteArticles",
+			method:           http.MethodDelete,
+			url:              "/admin/articles?site=vsd.fr",
+			mockStore:        &mockStore{storedArticles: []store.Article{storedArticle}},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"deleted":1`,
+		},
+		{
+			name:           "DeleteSiteArticlesWithoutSite",
+			method:         http.MethodDelete,
+			url:            "/admin/articles",
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:             "UpsertArticle",
+			method:           http.MethodPost,
+			url:              "/admin/articles",
+			body:             `{"title": "Macron annonce", "url": "https://www.vsd.fr/macron-annonce", "published_at": "2025-03-14T09:30:00Z", "text": "Macron annonce. Une description."}`,
+			mockStore:        &mockStore{},
+			mockVectorizer:   &mockVectorizer{embedding: storedArticle.Embedding},
+			expectedStatus:   http.StatusOK,
+			expectedContains: `"site":"vsd.fr"`,
+			expectedStored:   []store.Article{storedArticle},
+		},
+		{
+			name:           "UpsertArticleMissingURL",
+			method:         http.MethodPost,
+			url:            "/admin/articles",
+			body:           `{"title": "Macron annonce"}`,
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "UpsertArticleVectorizerError",
+			method:         http.MethodPost,
+			url:            "/admin/articles",
+			body:           `{"title": "Macron annonce", "url": "https://www.vsd.fr/macron-annonce"}`,
+			mockStore:      &mockStore{},
+			mockVectorizer: &mockVectorizer{err: errors.New("vectorizer down")},
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:            tc.mockStore,
+				vectorizerClient: tc.mockVectorizer,
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts:             Options{AdminToken: "secret"},
+			}
+
+			req := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+
+			require.Equal(t, tc.expectedStatus, w.Code, w.Body.String())
+			if tc.expectedContains != "" {
+				assert.Contains(t, w.Body.String(), tc.expectedContains)
+			}
+			if w.Code >= http.StatusBadRequest {
+				var response ErrorResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			}
+			if tc.expectedStored != nil {
+				assert.Equal(t, tc.expectedStored, tc.mockStore.storedArticles)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// Admission bounds the calls in flight to the vectorizers, which process their
+// requests one at a time, so that a burst of searches is shed rather than
+// piled up until the clients time out.
+type Admission struct {
+	// MaxConcurrent is the number of vectorizer calls in flight, admission
+	// control being disabled when zero.
+	MaxConcurrent int
+	// MaxQueue is the number of calls waiting for a slot, beyond which the
+	// calls are shed at once.
+	MaxQueue int
+	// MaxQueueWait is the time a call waits for a slot before being shed.
+	MaxQueueWait time.Duration
+}
+
+func (a Admission) enabled() bool {
+	return a.MaxConcurrent > 0
+}
+
+// errOverloaded is returned when a vectorizer call is shed.
+var errOverloaded = errors.New("vectorizer overloaded")
+
+// AdmissionStats are the counters of the admission control, reported by the
+// health endpoint.
+type AdmissionStats struct {
+	InFlight      int   `json:"in_flight"`
+	Queued        int   `json:"queued"`
+	MaxConcurrent int   `json:"max_concurrent"`
+	MaxQueue      int   `json:"max_queue"`
+	Shed          int64 `json:"shed"`
+}
+
+// admissionController admits the vectorizer calls in the slots of a
+// semaphore, queuing them for a bounded time when all are taken.
+type admissionController struct {
+	limits Admission
+	slots  chan struct{}
+	queued atomic.Int64
+	shed   atomic.Int64
+}
+
+func newAdmissionController(limits Admission) *admissionController {
+	if !limits.enabled() {
+		return nil
+	}
+	return &admissionController{limits: limits, slots: make(chan struct{}, limits.MaxConcurrent)}
+}
+
+// admit waits for a slot, and returns the function releasing it. It fails with
+// errOverloaded when the queue is full or the wait exceeds its maximum, and
+// with the context error when the caller gives up. A nil controller admits
+// every call.
+func (c *admissionController) admit(ctx context.Context) (func(), error) {
+	if c == nil {
+		return func() {}, nil
+	}
+	release := func() { <-c.slots }
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	if c.queued.Add(1) > int64(c.limits.MaxQueue) {
+		c.queued.Add(-1)
+		c.shed.Add(1)
+		return nil, errOverloaded
+	}
+	defer c.queued.Add(-1)
+	timer := time.NewTimer(c.limits.MaxQueueWait)
+	defer timer.Stop()
+	select {
+	case c.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		c.shed.Add(1)
+		return nil, errOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// stats returns the current counters of the controller.
+func (c *admissionController) stats() *AdmissionStats {
+	if c == nil {
+		return nil
+	}
+	return &AdmissionStats{
+		InFlight:      len(c.slots),
+		Queued:        int(c.queued.Load()),
+		MaxConcurrent: c.limits.MaxConcurrent,
+		MaxQueue:      c.limits.MaxQueue,
+		Shed:          c.shed.Load(),
+	}
+}
+
+// admissionError returns the error of a vectorizer call that was not admitted.
+func admissionError(err error) *APIError {
+	if errors.Is(err, errOverloaded) {
+		return newAPIError(CodeOverloaded, "The service is overloaded")
+	}
+	return upstreamError(err, CodeEmbeddingUnavailable, "Failed to generate query embedding")
+}
@@ -0,0 +1,169 @@
+package retrieval
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// blockingVectorizer implements the Vectorizer interface for testing, its
+// calls blocking until unblocked.
+type blockingVectorizer struct {
+	mockVectorizer
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingVectorizer) Vectorize(text string) ([]byte, error) {
+	b.started <- struct{}{}
+	<-b.unblock
+	return b.mockVectorizer.Vectorize(text)
+}
+
+func TestAdmissionController(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		controller := newAdmissionController(Admission{})
+		release, err := controller.admit(context.Background())
+		require.NoError(t, err)
+		release()
+		assert.Nil(t, controller.stats())
+	})
+
+	t.Run("QueueFull", func(t *testing.T) {
+		controller := newAdmissionController(Admission{MaxConcurrent: 1, MaxQueueWait: time.Second})
+		release, err := controller.admit(context.Background())
+		require.NoError(t, err)
+		_, err = controller.admit(context.Background())
+		assert.ErrorIs(t, err, errOverloaded)
+		release()
+
+		release, err = controller.admit(context.Background())
+		require.NoError(t, err)
+		release()
+		assert.Equal(t, &AdmissionStats{MaxConcurrent: 1, Shed: 1}, controller.stats())
+	})
+
+	t.Run("QueueWait", func(t *testing.T) {
+		controller := newAdmissionController(Admission{MaxConcurrent: 1, MaxQueue: 1, MaxQueueWait: time.Second})
+		release, err := controller.admit(context.Background())
+		require.NoError(t, err)
+
+		admitted := make(chan error)
+		go func() {
+			release, err := controller.admit(context.Background())
+			if err == nil {
+				release()
+			}
+			admitted <- err
+		}()
+		require.Eventually(t, func() bool { return controller.stats().Queued == 1 }, time.Second, time.Millisecond)
+		_, err = controller.admit(context.Background())
+		assert.ErrorIs(t, err, errOverloaded)
+		release()
+		assert.NoError(t, <-admitted)
+		assert.Equal(t, &AdmissionStats{MaxConcurrent: 1, MaxQueue: 1, Shed: 1}, controller.stats())
+	})
+
+	t.Run("MaxQueueWait", func(t *testing.T) {
+		controller := newAdmissionController(Admission{MaxConcurrent: 1, MaxQueue: 1, MaxQueueWait: 10 * time.Millisecond})
+		release, err := controller.admit(context.Background())
+		require.NoError(t, err)
+		defer release()
+		_, err = controller.admit(context.Background())
+		assert.ErrorIs(t, err, errOverloaded)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		controller := newAdmissionController(Admission{MaxConcurrent: 1, MaxQueue: 1, MaxQueueWait: time.Second})
+		release, err := controller.admit(context.Background())
+		require.NoError(t, err)
+		defer release()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = controller.admit(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Zero(t, controller.stats().Shed)
+	})
+}
+
+func TestSearchLoadShedding(t *testing.T) {
+	vectorizer := &blockingVectorizer{
+		mockVectorizer: mockVectorizer{embedding: []byte("test-embedding")},
+		started:        make(chan struct{}),
+		unblock:        make(chan struct{}),
+	}
+	server, err := New("0", &mockStore{searchResults: []store.SearchHit{{ID: "a", Title: "A"}}}, vectorizer,
+		slog.New(slog.NewTextHandler(io.Discard, nil)), Options{Admission: Admission{MaxConcurrent: 1, MaxQueueWait: time.Second}})
+	require.NoError(t, err)
+	handler := server.routes()
+
+	// The first search takes the only slot, the second one is shed.
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/search?q=first", nil))
+		close(done)
+	}()
+	<-vectorizer.started
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=second", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	var errResp ErrorResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+	assert.Equal(t, CodeOverloaded, errResp.Error.Code)
+	assert.True(t, errResp.Error.Retryable)
+
+	// Vector searches do not call the vectorizer, and are not shed.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?vector=AACAPw==", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var health HealthResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&health))
+	assert.Equal(t, HealthResponse{Status: "ok", Admission: &AdmissionStats{InFlight: 1, MaxConcurrent: 1, Shed: 1}}, health)
+
+	close(vectorizer.unblock)
+	<-done
+	assert.Equal(t, http.StatusOK, first.Code)
+}
+
+func TestRerankLoadShedding(t *testing.T) {
+	reranker := &mockReranker{scores: map[string]float64{"A": 0.1, "B": 0.9}}
+	server, err := New("0", &mockStore{}, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+		Admission: Admission{MaxConcurrent: 1, MaxQueueWait: time.Second},
+		Reranker:  reranker,
+	})
+	require.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	candidates := []store.SearchHit{{ID: "a", Title: "A"}, {ID: "b", Title: "B"}}
+
+	// The reranking is shed while the vectorizer slot is taken, the
+	// candidates being left in vector order.
+	release, err := server.admission.admit(context.Background())
+	require.NoError(t, err)
+	reranked, _, ok := server.rerank(context.Background(), logger, "query", candidates)
+	assert.False(t, ok)
+	assert.Equal(t, candidates, reranked)
+	assert.Nil(t, reranker.lastDocuments)
+	assert.Equal(t, int64(1), server.admission.stats().Shed)
+	release()
+
+	reranked, _, ok = server.rerank(context.Background(), logger, "query", candidates)
+	assert.True(t, ok)
+	assert.Equal(t, "b", reranked[0].ID)
+	assert.Zero(t, server.admission.stats().InFlight)
+}
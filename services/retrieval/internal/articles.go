@@ -0,0 +1,88 @@
+package retrieval
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// dateLayout is the layout of the date-only filters.
+const dateLayout = "2006-01-02"
+
+// handleSimilar handles the /articles/{id}/similar endpoint, returning the
+// articles most similar to a stored one. The stored article embedding is
+// used, so no vectorization is needed.
+func (s *Server) handleSimilar(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	limit, opts, apiErr := parseSimilarParams(r.URL.Query())
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+
+	hits, err := articleStore.SimilarArticles(r.Context(), id, limit, opts)
+	if errors.Is(err, store.ErrArticleNotFound) {
+		s.writeError(w, r, newAPIError(CodeArticleNotFound, fmt.Sprintf("Article %q not found", id)))
+		return
+	}
+	if err != nil {
+		s.logger.Error("Similar articles search failed", "error", err, "id", id, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Similar articles search failed"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, newSearchResponse(hits))
+}
+
+// parseSimilarParams reads the limit and the filters of a similar articles
+// search from the query string parameters.
+func parseSimilarParams(params url.Values) (int, store.SearchOptions, *APIError) {
+	opts := store.SearchOptions{Site: params.Get("site")}
+
+	limit := defaultLimit
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLimit {
+			return 0, opts, newAPIError(CodeInvalidRequest, fmt.Sprintf("Limit must be between 1 and %d", maxLimit))
+		}
+		limit = n
+	}
+
+	var err error
+	if opts.PublishedAfter, err = parseDateParam(params.Get("from"), false); err != nil {
+		return 0, opts, newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid from date: %v", err))
+	}
+	if opts.PublishedBefore, err = parseDateParam(params.Get("to"), true); err != nil {
+		return 0, opts, newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid to date: %v", err))
+	}
+	return limit, opts, nil
+}
+
+// parseDateParam parses a RFC 3339 timestamp or a date. A date is interpreted
+// as the start of the day, or as its end when endOfDay is set.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date (%s) or a RFC 3339 timestamp, got %q", dateLayout, value)
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Second)
+	}
+	return t, nil
+}
@@ -0,0 +1,113 @@
+package retrieval
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestHandleSimilar(t *testing.T) {
+	testCases := []struct {
+		name              string
+		url               string
+		mockStore         *mockStore
+		expectedStatus    int
+		expectedErrorCode ErrorCode
+		expectedID        string
+		expectedK         int
+		expectedOpts      store.SearchOptions
+		expectedCount     int
+	}{
+		{
+			name: "Success",
+			url:  "/articles/Macron%20annonce/similar",
+			mockStore: &mockStore{
+				searchResults: []store.SearchHit{
+					{ID: "Macron renonce", Title: "Macron renonce", Link: "http://vsd.fr/2", Score: 0.1},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedID:     "Macron annonce",
+			expectedK:      defaultLimit,
+			expectedCount:  1,
+		},
+		{
+			name:           "EscapedSlash",
+			url:            "/articles/24%2F7%20news/similar",
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusOK,
+			expectedID:     "24/7 news",
+			expectedK:      defaultLimit,
+		},
+		{
+			name:           "Filters",
+			url:            "/articles/Macron%20annonce/similar?limit=3&site=vsd.fr&from=2025-01-01&to=2025-01-31",
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusOK,
+			expectedID:     "Macron annonce",
+			expectedK:      3,
+			expectedOpts: store.SearchOptions{
+				Site:            "vsd.fr",
+				PublishedAfter:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				PublishedBefore: time.Date(2025, 1, 31, 23, 59, 59, 0, time.UTC),
+			},
+		},
+		{
+			name:              "InvalidDate",
+			url:               "/articles/Macron%20annonce/similar?from=yesterday",
+			mockStore:         &mockStore{},
+			expectedStatus:    http.StatusBadRequest,
+			expectedErrorCode: CodeInvalidRequest,
+		},
+		{
+			name:              "NotFound",
+			url:               "/articles/unknown/similar",
+			mockStore:         &mockStore{searchErr: store.ErrArticleNotFound},
+			expectedStatus:    http.StatusNotFound,
+			expectedErrorCode: CodeArticleNotFound,
+		},
+		{
+			name:              "StoreError",
+			url:               "/articles/Macron%20annonce/similar",
+			mockStore:         &mockStore{searchErr: errors.New("connection refused")},
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedErrorCode: CodeStoreUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:  tc.mockStore,
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			require.Equal(t, tc.expectedStatus, w.Code)
+
+			if tc.expectedStatus != http.StatusOK {
+				var response ErrorResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Equal(t, tc.expectedErrorCode, response.Error.Code)
+				return
+			}
+
+			var response SearchResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, tc.expectedCount, response.Count)
+			assert.Equal(t, tc.expectedID, tc.mockStore.lastID)
+			assert.Equal(t, tc.expectedK, tc.mockStore.lastK)
+			assert.Equal(t, tc.expectedOpts, tc.mockStore.lastOpts)
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package retrieval
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RateLimiter takes tokens from the token buckets of the API clients. It is
+// expected to be shared by the replicas of the service.
+type RateLimiter interface {
+	TakeTokens(ctx context.Context, bucket string, rate float64, burst, cost int) (bool, time.Duration, error)
+}
+
+// RateLimit is the token bucket of an API client: up to Burst requests at
+// once, refilled at PerSecond requests per second. It is disabled when
+// PerSecond is zero.
+type RateLimit struct {
+	PerSecond float64
+	Burst     int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.PerSecond > 0
+}
+
+// rateLimitTimeout bounds the time spent taking tokens, after which the
+// request is let through.
+const rateLimitTimeout = 100 * time.Millisecond
+
+// requestAPIKey returns the API key of the request, from the X-API-Key header
+// or as a bearer token.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return key
+}
+
+// lookupAPIKey returns the collections an API key grants access to, and
+// whether the key is valid. Every key is compared in constant time, so that
+// the time taken does not reveal how close to a valid key the given one is.
+func (s *Server) lookupAPIKey(key string) ([]string, bool) {
+	var granted []string
+	valid := false
+	for apiKey, collections := range s.opts.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(apiKey)) == 1 {
+			granted, valid = collections, true
+		}
+	}
+	return granted, valid
+}
+
+type rateLimitBucketKey struct{}
+
+// rateLimitBucket is the token bucket charged for a request.
+type rateLimitBucket struct {
+	name  string
+	limit RateLimit
+}
+
+// requireAPIAccess authenticates the callers of the API, and limits their
+// rate. Every caller is limited per IP address, the callers with an API key
+// being limited per key too, and the admins are not limited. Anonymous callers
+// are rejected when an API key is required.
+func (s *Server) requireAPIAccess(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.isAdmin(r) {
+			next(w, r)
+			return
+		}
+
+		// The IP address is charged before the API key is validated, so that
+		// the keys cannot be guessed faster than its limit.
+		bucket := rateLimitBucket{name: "ip:" + s.clientIP(r), limit: s.opts.IPRateLimit}
+		if apiErr := s.takeBucketTokens(r, bucket, 1); apiErr != nil {
+			s.writeError(w, r, apiErr)
+			return
+		}
+		if key := requestAPIKey(r); key != "" {
+			if _, valid := s.lookupAPIKey(key); !valid {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				s.writeError(w, r, newAPIError(CodeUnauthorized, "Invalid API key"))
+				return
+			}
+			digest := sha256.Sum256([]byte(key))
+			bucket = rateLimitBucket{name: "key:" + hex.EncodeToString(digest[:8]), limit: s.opts.KeyRateLimit}
+			if apiErr := s.takeBucketTokens(r, bucket, 1); apiErr != nil {
+				s.writeError(w, r, apiErr)
+				return
+			}
+		} else if s.opts.RequireAPIKey {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			s.writeError(w, r, newAPIError(CodeUnauthorized, "An API key is required"))
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), rateLimitBucketKey{}, bucket))
+		next(w, r)
+	})
+}
+
+// takeRateLimitTokens charges tokens to the bucket of the request, for the
+// requests costing more than the token taken by requireAPIAccess, such as
+// batches. The requests costing more than the burst are rejected, as the
+// bucket never holds their tokens.
+func (s *Server) takeRateLimitTokens(r *http.Request, cost int) *APIError {
+	bucket, ok := r.Context().Value(rateLimitBucketKey{}).(rateLimitBucket)
+	if !ok || !bucket.limit.enabled() || s.opts.RateLimiter == nil || cost <= 0 {
+		return nil
+	}
+	if cost+1 > bucket.limit.Burst {
+		return newAPIError(CodeInvalidRequest, fmt.Sprintf("The request costs %d requests, above the rate limit burst of %d", cost+1, bucket.limit.Burst))
+	}
+	return s.takeBucketTokens(r, bucket, cost)
+}
+
+// takeBucketTokens takes cost tokens from a bucket. The request is let through
+// when the rate limiter fails.
+func (s *Server) takeBucketTokens(r *http.Request, bucket rateLimitBucket, cost int) *APIError {
+	if !bucket.limit.enabled() || s.opts.RateLimiter == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), rateLimitTimeout)
+	defer cancel()
+	allowed, wait, err := s.opts.RateLimiter.TakeTokens(ctx, bucket.name, bucket.limit.PerSecond, bucket.limit.Burst, cost)
+	if err != nil {
+		s.logger.Warn("Failed to take rate limit tokens", "error", err, "bucket", bucket.name, "request_id", requestID(r))
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+	apiErr := newAPIError(CodeRateLimited, fmt.Sprintf("Rate limit of %g requests per second exceeded", bucket.limit.PerSecond))
+	apiErr.RetryAfter = max(1, int(math.Ceil(wait.Seconds())))
+	return apiErr
+}
+
+// clientIP returns the IP address of the client, read from the header set by
+// a trusted reverse proxy when configured. The rightmost address of the header
+// is used, as the one appended by the proxy: the ones before it are set by the
+// client, and could be rotated to evade the rate limit.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.opts.ClientIPHeader != "" {
+		values := r.Header.Values(s.opts.ClientIPHeader)
+		if len(values) > 0 {
+			addresses := strings.Split(values[len(values)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(addresses[len(addresses)-1])); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
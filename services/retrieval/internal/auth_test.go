@@ -0,0 +1,274 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// mockRateLimiter implements the RateLimiter interface for testing. Each
+// bucket has tokens requests, refilled after wait.
+type mockRateLimiter struct {
+	mu      sync.Mutex
+	tokens  int
+	wait    time.Duration
+	err     error
+	taken   map[string]int
+	buckets []string
+	costs   []int
+}
+
+func (m *mockRateLimiter) TakeTokens(ctx context.Context, bucket string, rate float64, burst, cost int) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets = append(m.buckets, bucket)
+	m.costs = append(m.costs, cost)
+	if m.err != nil {
+		return false, 0, m.err
+	}
+	if m.taken == nil {
+		m.taken = make(map[string]int)
+	}
+	if m.taken[bucket]+cost > m.tokens {
+		return false, m.wait, nil
+	}
+	m.taken[bucket] += cost
+	return true, 0, nil
+}
+
+func TestRequireAPIAccess(t *testing.T) {
+	limit := RateLimit{PerSecond: 1, Burst: 2}
+	testCases := []struct {
+		name            string
+		opts            Options
+		limiter         *mockRateLimiter
+		method          string
+		target          string
+		body            string
+		headers         map[string]string
+		requests        int
+		expectedStatus  int
+		expectedCode    ErrorCode
+		expectedBuckets []string
+		expectedCosts   []int
+	}{
+		{
+			name:           "Anonymous",
+			target:         "/search?q=test",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "APIKeyRequired",
+			opts:           Options{RequireAPIKey: true},
+			target:         "/search?q=test",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeUnauthorized,
+		},
+		{
+			name:           "APIKeyHeader",
+			opts:           Options{RequireAPIKey: true},
+			target:         "/search?q=test",
+			headers:        map[string]string{apiKeyHeader: "client-key"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "BearerToken",
+			opts:           Options{RequireAPIKey: true},
+			target:         "/suggest?prefix=test",
+			headers:        map[string]string{"Authorization": "Bearer client-key"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "InvalidAPIKey",
+			target:         "/search?q=test",
+			headers:        map[string]string{apiKeyHeader: "guess"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeUnauthorized,
+		},
+		{
+			name:           "Admin",
+			opts:           Options{RequireAPIKey: true, IPRateLimit: limit},
+			limiter:        &mockRateLimiter{},
+			target:         "/search?q=test",
+			headers:        map[string]string{"Authorization": "Bearer secret"},
+			requests:       3,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:            "IPRateLimit",
+			opts:            Options{IPRateLimit: limit},
+			limiter:         &mockRateLimiter{tokens: 2, wait: 2500 * time.Millisecond},
+			target:          "/search?q=test",
+			requests:        3,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedCode:    CodeRateLimited,
+			expectedBuckets: []string{"ip:192.0.2.1", "ip:192.0.2.1", "ip:192.0.2.1"},
+			expectedCosts:   []int{1, 1, 1},
+		},
+		{
+			name:            "ClientIPHeader",
+			opts:            Options{IPRateLimit: limit, ClientIPHeader: "X-Real-IP"},
+			limiter:         &mockRateLimiter{tokens: 2},
+			target:          "/search?q=test",
+			headers:         map[string]string{"X-Real-IP": "203.0.113.7"},
+			expectedStatus:  http.StatusOK,
+			expectedBuckets: []string{"ip:203.0.113.7"},
+			expectedCosts:   []int{1},
+		},
+		{
+			// The IP limit is disabled, the keyed requests are only limited
+			// per key.
+			name:            "KeyRateLimit",
+			opts:            Options{KeyRateLimit: limit},
+			limiter:         &mockRateLimiter{tokens: 1},
+			target:          "/search?q=test",
+			headers:         map[string]string{apiKeyHeader: "client-key"},
+			requests:        2,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedCode:    CodeRateLimited,
+			expectedBuckets: []string{"key:8eb943e7040b69a9", "key:8eb943e7040b69a9"},
+			expectedCosts:   []int{1, 1},
+		},
+		{
+			name:            "KeyAndIPRateLimit",
+			opts:            Options{KeyRateLimit: limit, IPRateLimit: limit},
+			limiter:         &mockRateLimiter{tokens: 2},
+			target:          "/search?q=test",
+			headers:         map[string]string{apiKeyHeader: "client-key"},
+			expectedStatus:  http.StatusOK,
+			expectedBuckets: []string{"ip:192.0.2.1", "key:8eb943e7040b69a9"},
+			expectedCosts:   []int{1, 1},
+		},
+		{
+			// The invalid keys are charged to the IP address, and cannot be
+			// guessed beyond its limit.
+			name:            "InvalidAPIKeyRateLimit",
+			opts:            Options{IPRateLimit: limit},
+			limiter:         &mockRateLimiter{tokens: 2},
+			target:          "/search?q=test",
+			headers:         map[string]string{apiKeyHeader: "guess"},
+			requests:        3,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedCode:    CodeRateLimited,
+			expectedBuckets: []string{"ip:192.0.2.1", "ip:192.0.2.1", "ip:192.0.2.1"},
+			expectedCosts:   []int{1, 1, 1},
+		},
+		{
+			// The addresses set by the client before the one appended by the
+			// proxy are ignored.
+			name:            "ForwardedFor",
+			opts:            Options{IPRateLimit: limit, ClientIPHeader: "X-Forwarded-For"},
+			limiter:         &mockRateLimiter{tokens: 2},
+			target:          "/search?q=test",
+			headers:         map[string]string{"X-Forwarded-For": "198.51.100.1, 203.0.113.7"},
+			expectedStatus:  http.StatusOK,
+			expectedBuckets: []string{"ip:203.0.113.7"},
+			expectedCosts:   []int{1},
+		},
+		{
+			name:            "RateLimiterError",
+			opts:            Options{IPRateLimit: limit},
+			limiter:         &mockRateLimiter{err: errors.New("connection refused")},
+			target:          "/search?q=test",
+			requests:        3,
+			expectedStatus:  http.StatusOK,
+			expectedBuckets: []string{"ip:192.0.2.1", "ip:192.0.2.1", "ip:192.0.2.1"},
+			expectedCosts:   []int{1, 1, 1},
+		},
+		{
+			name:            "Batch",
+			opts:            Options{IPRateLimit: limit},
+			limiter:         &mockRateLimiter{tokens: 1},
+			method:          http.MethodPost,
+			target:          "/search/batch",
+			body:            `[{"query": "a"}, {"query": "b"}]`,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedCode:    CodeRateLimited,
+			expectedBuckets: []string{"ip:192.0.2.1", "ip:192.0.2.1"},
+			expectedCosts:   []int{1, 1},
+		},
+		{
+			// The batches costing more than the burst are never let through.
+			name:            "BatchAboveBurst",
+			opts:            Options{IPRateLimit: limit},
+			limiter:         &mockRateLimiter{tokens: 10},
+			method:          http.MethodPost,
+			target:          "/search/batch",
+			body:            `[{"query": "a"}, {"query": "b"}, {"query": "c"}]`,
+			expectedStatus:  http.StatusBadRequest,
+			expectedCode:    CodeInvalidRequest,
+			expectedBuckets: []string{"ip:192.0.2.1"},
+			expectedCosts:   []int{1},
+		},
+		{
+			name:           "Health",
+			opts:           Options{RequireAPIKey: true, IPRateLimit: limit},
+			limiter:        &mockRateLimiter{},
+			target:         "/health",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.AdminToken = "secret"
+			opts.APIKeys = map[string][]string{"client-key": nil}
+			if tc.limiter != nil {
+				opts.RateLimiter = tc.limiter
+			}
+			server := &Server{
+				store:            &mockStore{searchResults: []store.SearchHit{{ID: "a", Title: "A"}}},
+				vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts:             opts,
+			}
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			var w *httptest.ResponseRecorder
+			for range max(tc.requests, 1) {
+				req := httptest.NewRequest(method, tc.target, strings.NewReader(tc.body))
+				for name, value := range tc.headers {
+					req.Header.Set(name, value)
+				}
+				w = httptest.NewRecorder()
+				server.routes().ServeHTTP(w, req)
+			}
+			require.Equal(t, tc.expectedStatus, w.Code)
+			if tc.limiter != nil {
+				assert.Equal(t, tc.expectedBuckets, tc.limiter.buckets)
+				assert.Equal(t, tc.expectedCosts, tc.limiter.costs)
+			}
+			if tc.expectedCode == "" {
+				return
+			}
+
+			var errResp ErrorResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+			assert.Equal(t, tc.expectedCode, errResp.Error.Code)
+			if tc.expectedCode == CodeRateLimited {
+				assert.True(t, errResp.Error.Retryable)
+				expectedRetryAfter := "1"
+				if tc.limiter.wait > time.Second {
+					expectedRetryAfter = "3"
+				}
+				assert.Equal(t, expectedRetryAfter, w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
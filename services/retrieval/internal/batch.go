@@ -0,0 +1,236 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/turanic/gs_search/pkg/store"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// maxBatchSize is the maximum number of searches of a batch.
+	maxBatchSize = 100
+	// maxBatchBodyBytes caps the size of the batch search payloads.
+	maxBatchBodyBytes = 1 << 20
+	// batchConcurrency is the number of searches of a batch whose results
+	// are reordered concurrently, as reranking calls the reranker.
+	batchConcurrency = 8
+)
+
+// BatchSearchResult is the result of a search of a batch: either its
+// response or its error.
+type BatchSearchResult struct {
+	Response *SearchResponse `json:"response,omitempty"`
+	Error    *APIError       `json:"error,omitempty"`
+}
+
+// BatchSearchResponse represents the batch search response payload, with a
+// result per search in the order of the requests.
+type BatchSearchResponse struct {
+	Results []BatchSearchResult `json:"results"`
+	Count   int                 `json:"count"`
+}
+
+// handleSearchBatch handles the /search/batch endpoint, running an array of
+// search requests. The response is successful whatever the errors of the
+// searches, which are reported with their results.
+func (s *Server) handleSearchBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeError(w, r, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	var reqs []SearchRequest
+	if apiErr := decodeRequestLimit(w, r, &reqs, maxBatchBodyBytes); apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	if len(reqs) == 0 || len(reqs) > maxBatchSize {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, fmt.Sprintf("A batch must have between 1 and %d searches", maxBatchSize)))
+		return
+	}
+	// The first search was charged with the request.
+	if apiErr := s.takeRateLimitTokens(r, len(reqs)-1); apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+
+	session := s.variantSession(w, r, false)
+	for i := range reqs {
+		reqs[i].session = session
+	}
+	admin := s.isAdmin(r)
+	results := s.searchBatch(r.Context(), reqs, func(req *SearchRequest) *APIError {
+		if req.Explain && !admin {
+			return newAPIError(CodeUnauthorized, "Explain requires the admin token")
+		}
+		return s.authorizeCollection(r, req.Collection)
+	})
+	for i := range results {
+		if results[i].Error != nil {
+			results[i].Error.RequestID = requestID(r)
+		}
+	}
+	s.writeJSON(w, http.StatusOK, BatchSearchResponse{Results: results, Count: len(results)})
+}
+
+// searchBatch runs the search requests as search does, with a single
+// vectorization per collection and variant, and the vector searches of each
+// in a single pipeline. The requests rejected by check are not run.
+func (s *Server) searchBatch(ctx context.Context, reqs []SearchRequest, check func(*SearchRequest) *APIError) []BatchSearchResult {
+	results := make([]BatchSearchResult, len(reqs))
+	plans := make([]*searchPlan, len(reqs))
+	// The searches are grouped by collection and variant, as each has its own
+	// vectorizer and store.
+	type group struct{ collection, variant string }
+	groups := make(map[group][]int)
+	for i := range reqs {
+		if apiErr := check(&reqs[i]); apiErr != nil {
+			results[i].Error = apiErr
+			continue
+		}
+		plan, apiErr := s.planSearch(ctx, &reqs[i])
+		if apiErr != nil {
+			results[i].Error = apiErr
+			continue
+		}
+		plans[i] = plan
+		key := group{collection: reqs[i].Collection, variant: plan.variant.Name}
+		groups[key] = append(groups[key], i)
+	}
+
+	var wg sync.WaitGroup
+	hits := make([]store.VectorSearchResult, len(reqs))
+	for _, indexes := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.vectorSearchBatch(ctx, plans, indexes, hits)
+		}()
+	}
+	wg.Wait()
+
+	grp := new(errgroup.Group)
+	grp.SetLimit(batchConcurrency)
+	for i, plan := range plans {
+		if plan == nil {
+			continue
+		}
+		grp.Go(func() error {
+			if err := hits[i].Err; err != nil {
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) {
+					apiErr = vectorSearchError(plan, err)
+				}
+				results[i].Error = s.failSearch(ctx, plan, apiErr)
+				return nil
+			}
+			results[i].Response = s.completeSearch(ctx, plan, hits[i].Hits)
+			return nil
+		})
+	}
+	_ = grp.Wait()
+	return results
+}
+
+// vectorSearchBatch vectorizes the texts of the planned searches of a
+// collection and variant at once, and runs their vector searches in a single pipeline. The
+// hits are stored at the index of each search, an embedding failure being
+// reported as an *APIError. The searches of a text fall back to text searches
+// when the circuit of the vectorizer is open.
+func (s *Server) vectorSearchBatch(ctx context.Context, plans []*searchPlan, indexes []int, hits []store.VectorSearchResult) {
+	variant := plans[indexes[0]].variant
+	var texts []string
+	for _, i := range indexes {
+		texts = append(texts, plans[i].chunks...)
+	}
+	var embeddings [][]byte
+	if len(texts) > 0 {
+		release, err := s.admission.admit(ctx)
+		if err != nil {
+			s.logger.Warn("Query embeddings not admitted", "error", err, "variant", variant.Name, "count", len(texts), "request_id", requestIDFromContext(ctx))
+			apiErr := admissionError(err)
+			for _, i := range indexes {
+				hits[i].Err = apiErr
+			}
+			return
+		}
+		embeddings, err = variant.Vectorizer.VectorizeBatch(texts)
+		release()
+		switch {
+		case errors.Is(err, errCircuitOpen):
+			s.logger.Warn("Vectorizer circuit open, falling back to text searches", "variant", variant.Name, "request_id", requestIDFromContext(ctx))
+			s.textSearchBatch(ctx, plans, indexes, hits)
+			err = nil
+		case err == nil && len(embeddings) != len(texts):
+			err = fmt.Errorf("expected %d embeddings, got %d", len(texts), len(embeddings))
+		}
+		if err != nil {
+			s.logger.Error("Failed to generate query embeddings", "error", err, "variant", variant.Name, "count", len(texts), "request_id", requestIDFromContext(ctx))
+			apiErr := upstreamError(err, CodeEmbeddingUnavailable, "Failed to generate query embedding")
+			for _, i := range indexes {
+				hits[i].Err = apiErr
+			}
+			return
+		}
+	}
+
+	var vectorQueries []store.VectorQuery
+	var queried []int
+	for _, i := range indexes {
+		plan := plans[i]
+		if plan.degraded {
+			continue
+		}
+		embedding := plan.embedding
+		if embedding == nil {
+			// The embeddings of the search are consumed whether they pool or
+			// not, for the next searches to get their own.
+			chunkEmbeddings := embeddings[:len(plan.chunks)]
+			embeddings = embeddings[len(plan.chunks):]
+			var err error
+			if embedding, err = meanPool(chunkEmbeddings); err != nil {
+				plan.logger.Error("Failed to pool query embeddings", "error", err)
+				hits[i].Err = upstreamError(err, CodeEmbeddingUnavailable, "Failed to generate query embedding")
+				continue
+			}
+		}
+		plan.timer.lap("embedding")
+		vectorQueries = append(vectorQueries, store.VectorQuery{Embedding: embedding, K: plan.k, Opts: plan.searchOpts})
+		queried = append(queried, i)
+	}
+	if len(vectorQueries) == 0 {
+		return
+	}
+	batchHits := variant.Store.VectorSearchBatch(ctx, vectorQueries)
+	for j, i := range queried {
+		plans[i].timer.lap("vector_search")
+		hits[i] = batchHits[j]
+	}
+}
+
+// textSearchBatch degrades the planned searches of a text to text searches,
+// and runs them. The hits are stored at the index of each search.
+func (s *Server) textSearchBatch(ctx context.Context, plans []*searchPlan, indexes []int, hits []store.VectorSearchResult) {
+	for _, i := range indexes {
+		plan := plans[i]
+		if plan.embedding != nil {
+			continue
+		}
+		plan.degrade()
+		plan.timer.lap("embedding")
+		textHits, err := plan.variant.Store.TextSearch(ctx, plan.text, plan.k, plan.searchOpts)
+		plan.timer.lap("text_search")
+		if err != nil {
+			plan.logger.Error("Text search failed", "error", err)
+			hits[i].Err = upstreamError(err, CodeStoreUnavailable, "Text search failed")
+			continue
+		}
+		hits[i].Hits = textHits
+	}
+}
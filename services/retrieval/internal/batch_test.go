@@ -0,0 +1,214 @@
+package retrieval
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// batchVectorizer records the batches vectorized, for testing.
+type batchVectorizer struct {
+	mockVectorizer
+	batches [][]string
+}
+
+func (m *batchVectorizer) VectorizeBatch(texts []string) ([][]byte, error) {
+	m.batches = append(m.batches, texts)
+	return m.mockVectorizer.VectorizeBatch(texts)
+}
+
+func TestHandleSearchBatch(t *testing.T) {
+	hits := []store.SearchHit{{ID: "a", Title: "A"}, {ID: "b", Title: "B"}}
+	testCases := []struct {
+		name            string
+		method          string
+		body            string
+		vectorizer      *batchVectorizer
+		store           *mockStore
+		expectedStatus  int
+		expectedErrors  []ErrorCode
+		expectedBatches [][]string
+	}{
+		{
+			name:            "Success",
+			method:          http.MethodPost,
+			body:            `[{"query": "First  Query"}, {"query": " "}, {"query": "second query", "limit": 1}]`,
+			vectorizer:      &batchVectorizer{mockVectorizer: mockVectorizer{embedding: []byte("test-embedding")}},
+			store:           &mockStore{searchResults: hits},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []ErrorCode{"", CodeEmptyQuery, ""},
+			expectedBatches: [][]string{{"first query", "second query"}},
+		},
+		{
+			name:            "VectorAndDocument",
+			method:          http.MethodPost,
+			body:            `[{"query": "first query"}, {"vector": "AACAPw=="}, {"document": "A paragraph."}]`,
+			vectorizer:      &batchVectorizer{mockVectorizer: mockVectorizer{embedding: []byte("test-embedding")}},
+			store:           &mockStore{searchResults: hits},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []ErrorCode{"", "", ""},
+			expectedBatches: [][]string{{"first query", "a paragraph."}},
+		},
+		{
+			name:            "ExplainRequiresAdmin",
+			method:          http.MethodPost,
+			body:            `[{"query": "first query", "explain": true}, {"query": "second query"}]`,
+			vectorizer:      &batchVectorizer{mockVectorizer: mockVectorizer{embedding: []byte("test-embedding")}},
+			store:           &mockStore{searchResults: hits},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []ErrorCode{CodeUnauthorized, ""},
+			expectedBatches: [][]string{{"second query"}},
+		},
+		{
+			name:            "VectorizerError",
+			method:          http.MethodPost,
+			body:            `[{"query": "first query"}, {"query": "second query"}]`,
+			vectorizer:      &batchVectorizer{mockVectorizer: mockVectorizer{err: errors.New("connection refused")}},
+			store:           &mockStore{searchResults: hits},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []ErrorCode{CodeEmbeddingUnavailable, CodeEmbeddingUnavailable},
+			expectedBatches: [][]string{{"first query", "second query"}},
+		},
+		{
+			name:            "StoreError",
+			method:          http.MethodPost,
+			body:            `[{"query": "first query"}]`,
+			vectorizer:      &batchVectorizer{mockVectorizer: mockVectorizer{embedding: []byte("test-embedding")}},
+			store:           &mockStore{searchErr: errors.New("connection refused")},
+			expectedStatus:  http.StatusOK,
+			expectedErrors:  []ErrorCode{CodeStoreUnavailable},
+			expectedBatches: [][]string{{"first query"}},
+		},
+		{
+			name:           "EmptyBatch",
+			method:         http.MethodPost,
+			body:           `[]`,
+			vectorizer:     &batchVectorizer{},
+			store:          &mockStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "BatchTooLarge",
+			method:         http.MethodPost,
+			body:           "[" + strings.Repeat(`{"query": "q"},`, maxBatchSize) + `{"query": "q"}]`,
+			vectorizer:     &batchVectorizer{},
+			store:          &mockStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "NotAnArray",
+			method:         http.MethodPost,
+			body:           `{"query": "first query"}`,
+			vectorizer:     &batchVectorizer{},
+			store:          &mockStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "MethodNotAllowed",
+			method:         http.MethodGet,
+			vectorizer:     &batchVectorizer{},
+			store:          &mockStore{},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:            tc.store,
+				vectorizerClient: tc.vectorizer,
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			req := httptest.NewRequest(tc.method, "/search/batch", strings.NewReader(tc.body))
+			req.Header.Set(requestIDHeader, "test-request-id")
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+			require.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedBatches, tc.vectorizer.batches)
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var response BatchSearchResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			require.Len(t, response.Results, len(tc.expectedErrors))
+			assert.Equal(t, len(tc.expectedErrors), response.Count)
+			for i, code := range tc.expectedErrors {
+				result := response.Results[i]
+				if code != "" {
+					require.NotNil(t, result.Error, "result %d", i)
+					assert.Nil(t, result.Response)
+					assert.Equal(t, code, result.Error.Code)
+					assert.Equal(t, "test-request-id", result.Error.RequestID)
+					continue
+				}
+				require.Nil(t, result.Error, "result %d", i)
+				require.NotNil(t, result.Response)
+				assert.NotEmpty(t, result.Response.SearchID)
+				assert.Equal(t, len(hits), result.Response.Count)
+			}
+		})
+	}
+}
+
+// poolErrorVectorizer returns the embeddings of the queries it knows, and for the
+// other texts embeddings of a length growing with their position, which fail
+// to pool.
+type poolErrorVectorizer struct {
+	mockVectorizer
+	queries map[string][]byte
+}
+
+func (m *poolErrorVectorizer) VectorizeBatch(texts []string) ([][]byte, error) {
+	embeddings := make([][]byte, len(texts))
+	for i, text := range texts {
+		if embedding, ok := m.queries[text]; ok {
+			embeddings[i] = embedding
+		} else {
+			embeddings[i] = make([]byte, 4*(i+1))
+		}
+	}
+	return embeddings, nil
+}
+
+func TestSearchBatchPoolError(t *testing.T) {
+	searchStore := &mockStore{searchResults: []store.SearchHit{{ID: "a", Title: "A"}}}
+	server := &Server{
+		store: searchStore,
+		vectorizerClient: &poolErrorVectorizer{queries: map[string][]byte{
+			"first query":  []byte("emb1"),
+			"second query": []byte("emb2"),
+		}},
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	document := strings.TrimSpace(strings.Repeat("word ", maxQueryTokens+maxQueryTokens/2))
+	chunks, apiErr := chunkDocument(normalizeQuery(document))
+	require.Nil(t, apiErr)
+	require.Greater(t, len(chunks), 1)
+
+	body, err := json.Marshal([]SearchRequest{{Query: "first query"}, {Document: document}, {Query: "second query"}})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/search/batch", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response BatchSearchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Len(t, response.Results, 3)
+	assert.NotNil(t, response.Results[0].Response)
+	require.NotNil(t, response.Results[1].Error)
+	assert.Equal(t, CodeEmbeddingUnavailable, response.Results[1].Error.Code)
+	// The search after the failing one is searched with its own embedding.
+	assert.NotNil(t, response.Results[2].Response)
+	assert.Equal(t, []byte("emb2"), searchStore.lastEmbedding)
+}
@@ -0,0 +1,160 @@
+package retrieval
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops calling a failing vectorizer, so that the searches fall
+// back to a text search at once rather than after its failure.
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures opening the
+	// circuit, the circuit breaker being disabled when zero.
+	FailureThreshold int
+	// OpenTimeout is the time the circuit stays open, before a single call
+	// probes whether the vectorizer recovered.
+	OpenTimeout time.Duration
+}
+
+func (c CircuitBreaker) enabled() bool {
+	return c.FailureThreshold > 0
+}
+
+// errCircuitOpen is returned by the vectorizers whose circuit is open.
+var errCircuitOpen = errors.New("vectorizer circuit open")
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker counts the consecutive failures of the calls. Once open, it
+// rejects the calls until the open timeout elapses, then lets a single probe
+// through, which closes the circuit on success and opens it again on failure.
+type circuitBreaker struct {
+	settings CircuitBreaker
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a call may be made.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.settings.OpenTimeout {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// The probe is in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+// record records the outcome of an allowed call, and returns the state of
+// the circuit before and after it.
+func (b *circuitBreaker) record(err error) (circuitState, circuitState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	from := b.state
+	if err == nil {
+		b.state, b.failures = circuitClosed, 0
+		return from, b.state
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.settings.FailureThreshold {
+		b.state, b.openedAt = circuitOpen, b.now()
+	}
+	return from, b.state
+}
+
+// currentState returns the state of the circuit.
+func (b *circuitBreaker) currentState() circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakerVectorizer is a vectorizer whose calls go through a circuit breaker.
+type breakerVectorizer struct {
+	Vectorizer
+	breaker *circuitBreaker
+	logger  *slog.Logger
+}
+
+// withCircuitBreaker wraps a vectorizer with a circuit breaker when enabled.
+func withCircuitBreaker(vectorizer Vectorizer, settings CircuitBreaker, logger *slog.Logger) Vectorizer {
+	if !settings.enabled() {
+		return vectorizer
+	}
+	return &breakerVectorizer{
+		Vectorizer: vectorizer,
+		breaker:    &circuitBreaker{settings: settings, now: time.Now},
+		logger:     logger,
+	}
+}
+
+// Vectorize implements the Vectorizer interface.
+func (v *breakerVectorizer) Vectorize(text string) ([]byte, error) {
+	if !v.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+	embedding, err := v.Vectorizer.Vectorize(text)
+	v.record(err)
+	return embedding, err
+}
+
+// VectorizeBatch implements the Vectorizer interface.
+func (v *breakerVectorizer) VectorizeBatch(texts []string) ([][]byte, error) {
+	if !v.breaker.allow() {
+		return nil, errCircuitOpen
+	}
+	embeddings, err := v.Vectorizer.VectorizeBatch(texts)
+	v.record(err)
+	return embeddings, err
+}
+
+// record records the outcome of a call, and logs the changes of the circuit.
+func (v *breakerVectorizer) record(err error) {
+	from, to := v.breaker.record(err)
+	switch {
+	case to == circuitOpen && from != circuitOpen:
+		v.logger.Warn("Vectorizer circuit opened", "error", err, "open_timeout", v.breaker.settings.OpenTimeout)
+	case to == circuitClosed && from != circuitClosed:
+		v.logger.Info("Vectorizer circuit closed")
+	}
+}
+
+// vectorizerCircuit returns the state of the circuit of a vectorizer, empty
+// when it has no circuit breaker.
+func vectorizerCircuit(vectorizer Vectorizer) string {
+	if v, ok := vectorizer.(*breakerVectorizer); ok {
+		return v.breaker.currentState().String()
+	}
+	return ""
+}
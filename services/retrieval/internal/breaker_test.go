@@ -0,0 +1,122 @@
+package retrieval
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	breaker := &circuitBreaker{
+		settings: CircuitBreaker{FailureThreshold: 2, OpenTimeout: time.Second},
+		now:      func() time.Time { return now },
+	}
+	failure := errors.New("connection refused")
+
+	// A success resets the consecutive failures.
+	require.True(t, breaker.allow())
+	breaker.record(failure)
+	require.True(t, breaker.allow())
+	breaker.record(nil)
+	require.True(t, breaker.allow())
+	breaker.record(failure)
+	assert.Equal(t, circuitClosed, breaker.currentState())
+
+	require.True(t, breaker.allow())
+	from, to := breaker.record(failure)
+	assert.Equal(t, circuitClosed, from)
+	assert.Equal(t, circuitOpen, to)
+	assert.False(t, breaker.allow())
+
+	// A single probe is let through after the open timeout, and opens the
+	// circuit again on failure.
+	now = now.Add(time.Second)
+	require.True(t, breaker.allow())
+	assert.Equal(t, circuitHalfOpen, breaker.currentState())
+	assert.False(t, breaker.allow())
+	from, to = breaker.record(failure)
+	assert.Equal(t, circuitHalfOpen, from)
+	assert.Equal(t, circuitOpen, to)
+	assert.False(t, breaker.allow())
+
+	now = now.Add(time.Second)
+	require.True(t, breaker.allow())
+	from, to = breaker.record(nil)
+	assert.Equal(t, circuitHalfOpen, from)
+	assert.Equal(t, circuitClosed, to)
+	assert.True(t, breaker.allow())
+}
+
+func TestSearchDegraded(t *testing.T) {
+	textStore := &mockStore{
+		searchResults: []store.SearchHit{{ID: "vector", Title: "Vector"}},
+		textResults:   []store.SearchHit{{ID: "text", Title: "Text", Score: 1}},
+	}
+	vectorizer := &mockVectorizer{err: errors.New("connection refused")}
+	server, err := New("0", textStore, vectorizer, slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Options{CircuitBreaker: CircuitBreaker{FailureThreshold: 2, OpenTimeout: time.Minute}})
+	require.NoError(t, err)
+	handler := server.routes()
+
+	search := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	// The searches fail until the circuit opens.
+	for range 2 {
+		w := search(http.MethodGet, "/search?q=test+query", "")
+		require.Equal(t, http.StatusBadGateway, w.Code)
+	}
+
+	w := search(http.MethodGet, "/search?q=test+query", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response SearchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.True(t, response.Degraded)
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "text", response.Results[0].ID)
+	assert.Equal(t, "test query", textStore.lastTextQuery)
+
+	// Vector searches do not need the vectorizer.
+	w = search(http.MethodGet, "/search?vector=AACAPw==", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	response = SearchResponse{}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.False(t, response.Degraded)
+	assert.Equal(t, "vector", response.Results[0].ID)
+
+	w = search(http.MethodPost, "/search/batch", `[{"query": "a"}, {"vector": "AACAPw=="}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var batch BatchSearchResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&batch))
+	require.Len(t, batch.Results, 2)
+	require.NotNil(t, batch.Results[0].Response)
+	assert.True(t, batch.Results[0].Response.Degraded)
+	assert.Equal(t, "text", batch.Results[0].Response.Results[0].ID)
+	require.NotNil(t, batch.Results[1].Response)
+	assert.False(t, batch.Results[1].Response.Degraded)
+	assert.Equal(t, "vector", batch.Results[1].Response.Results[0].ID)
+
+	// The text search failing is a store failure.
+	textStore.searchErr = errors.New("connection refused")
+	w = search(http.MethodGet, "/search?q=test+query", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = search(http.MethodGet, "/health", "")
+	var health HealthResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&health))
+	assert.Equal(t, "open", health.Circuit)
+}
@@ -0,0 +1,81 @@
+package retrieval
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// apiKeyHeader is the header carrying the API key of the callers, which may
+// also be provided as a bearer token.
+const apiKeyHeader = "X-API-Key"
+
+// validateCollections checks the names of the collections, and that the API
+// keys grant access to configured collections.
+func validateCollections(collections map[string]Store, apiKeys map[string][]string) error {
+	for name := range collections {
+		if name == "" {
+			return fmt.Errorf("the default collection cannot be configured as a named collection")
+		}
+		if err := store.ValidateCollection(name); err != nil {
+			return err
+		}
+	}
+	for key, names := range apiKeys {
+		if key == "" {
+			return fmt.Errorf("invalid empty API key")
+		}
+		for _, name := range names {
+			if _, ok := collections[name]; !ok {
+				return fmt.Errorf("API key grants access to the unknown collection %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// authorizeCollection checks that the caller may query a collection. The
+// default collection is open to every caller, the named ones require an API
+// key granting access to them, or the admin token.
+func (s *Server) authorizeCollection(r *http.Request, collection string) *APIError {
+	if collection == "" || s.isAdmin(r) {
+		return nil
+	}
+	key := requestAPIKey(r)
+	if key == "" {
+		return newAPIError(CodeUnauthorized, fmt.Sprintf("The collection %q requires an API key", collection))
+	}
+	granted, valid := s.lookupAPIKey(key)
+	if !valid {
+		return newAPIError(CodeUnauthorized, "Invalid API key")
+	}
+	if !slices.Contains(granted, collection) {
+		return newAPIError(CodeForbidden, fmt.Sprintf("The API key does not grant access to the collection %q", collection))
+	}
+	return nil
+}
+
+// collectionStore returns the store of a collection, the server store for the
+// default one.
+func (s *Server) collectionStore(collection string) (Store, *APIError) {
+	if collection == "" {
+		return s.store, nil
+	}
+	collectionStore, ok := s.opts.Collections[collection]
+	if !ok {
+		return nil, newAPIError(CodeCollectionNotFound, fmt.Sprintf("Collection %q not found", collection))
+	}
+	return collectionStore, nil
+}
+
+// requestStore returns the store of the collection requested with the
+// collection query parameter, when the caller may query it.
+func (s *Server) requestStore(r *http.Request) (Store, *APIError) {
+	collection := r.URL.Query().Get("collection")
+	if apiErr := s.authorizeCollection(r, collection); apiErr != nil {
+		return nil, apiErr
+	}
+	return s.collectionStore(collection)
+}
@@ -0,0 +1,167 @@
+package retrieval
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestValidateCollections(t *testing.T) {
+	collections := map[string]Store{"archive": &mockStore{}}
+	assert.NoError(t, validateCollections(collections, map[string][]string{"key": {"archive"}}))
+	assert.NoError(t, validateCollections(nil, nil))
+	assert.Error(t, validateCollections(map[string]Store{"": &mockStore{}}, nil))
+	assert.Error(t, validateCollections(map[string]Store{"Archive": &mockStore{}}, nil))
+	assert.Error(t, validateCollections(collections, map[string][]string{"key": {"partner"}}))
+	assert.Error(t, validateCollections(collections, map[string][]string{"": {"archive"}}))
+}
+
+func TestSearchCollections(t *testing.T) {
+	testCases := []struct {
+		name           string
+		target         string
+		body           string
+		apiKey         string
+		adminToken     string
+		expectedStatus int
+		expectedCode   ErrorCode
+		expectedID     string
+	}{
+		{
+			name:           "DefaultCollection",
+			target:         "/search",
+			body:           `{"query": "test query"}`,
+			expectedStatus: http.StatusOK,
+			expectedID:     "default",
+		},
+		{
+			name:           "NamedCollection",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "archive"}`,
+			apiKey:         "archive-key",
+			expectedStatus: http.StatusOK,
+			expectedID:     "archive",
+		},
+		{
+			name:           "NamedCollectionGet",
+			target:         "/search?q=test&collection=archive",
+			apiKey:         "archive-key",
+			expectedStatus: http.StatusOK,
+			expectedID:     "archive",
+		},
+		{
+			name:           "Admin",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "partner"}`,
+			adminToken:     "secret",
+			expectedStatus: http.StatusOK,
+			expectedID:     "partner",
+		},
+		{
+			name:           "MissingKey",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "archive"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeUnauthorized,
+		},
+		{
+			name:           "InvalidKey",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "archive"}`,
+			apiKey:         "guess",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   CodeUnauthorized,
+		},
+		{
+			name:           "CollectionNotGranted",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "partner"}`,
+			apiKey:         "archive-key",
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   CodeForbidden,
+		},
+		{
+			name:           "UnknownCollection",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "unknown"}`,
+			adminToken:     "secret",
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   CodeCollectionNotFound,
+		},
+		{
+			name:           "Variant",
+			target:         "/search",
+			body:           `{"query": "test query", "collection": "archive", "variant": "other"}`,
+			apiKey:         "archive-key",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   CodeInvalidRequest,
+		},
+		{
+			name:           "Similar",
+			target:         "/articles/a/similar?collection=archive",
+			apiKey:         "archive-key",
+			expectedStatus: http.StatusOK,
+			expectedID:     "archive",
+		},
+		{
+			name:           "SimilarNotGranted",
+			target:         "/articles/a/similar?collection=partner",
+			apiKey:         "archive-key",
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   CodeForbidden,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storeOf := func(id string) *mockStore {
+				return &mockStore{searchResults: []store.SearchHit{{ID: id, Title: id}}}
+			}
+			vectorizer := &mockVectorizer{embedding: []byte("test-embedding")}
+			server := &Server{
+				store:            storeOf("default"),
+				vectorizerClient: vectorizer,
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts: Options{
+					AdminToken:  "secret",
+					Variants:    []Variant{{Name: "other", Vectorizer: vectorizer, Store: storeOf("other")}},
+					Collections: map[string]Store{"archive": storeOf("archive"), "partner": storeOf("partner")},
+					APIKeys:     map[string][]string{"archive-key": {"archive"}},
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+			if tc.body != "" {
+				req = httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+			}
+			if tc.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tc.apiKey)
+			}
+			if tc.adminToken != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.adminToken)
+			}
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+			require.Equal(t, tc.expectedStatus, w.Code)
+
+			if tc.expectedCode != "" {
+				var errResp ErrorResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&errResp))
+				assert.Equal(t, tc.expectedCode, errResp.Error.Code)
+				return
+			}
+			var response SearchResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			require.Len(t, response.Results, 1)
+			assert.Equal(t, tc.expectedID, response.Results[0].ID)
+		})
+	}
+}
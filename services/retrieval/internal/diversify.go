@@ -0,0 +1,123 @@
+package retrieval
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// diversifyOptions holds the diversification settings of a search.
+type diversifyOptions struct {
+	// diversity trades the relevance of the results for their novelty, from
+	// 0 for relevance only to 1 for novelty only.
+	diversity float64
+	// dedupThreshold drops the candidates at least as similar to a result
+	// already selected, when positive.
+	dedupThreshold float64
+	// maxPerSite caps the number of results of each site, when positive.
+	maxPerSite int
+}
+
+// enabled reports whether the results are diversified.
+func (o diversifyOptions) enabled() bool {
+	return o.diversity > 0 || o.dedupThreshold > 0 || o.maxPerSite > 0
+}
+
+// needsEmbeddings reports whether the embeddings of the candidates are compared.
+func (o diversifyOptions) needsEmbeddings() bool {
+	return o.diversity > 0 || o.dedupThreshold > 0
+}
+
+// diversify reorders the candidates by Maximal Marginal Relevance: each
+// result is picked greedily for its similarity to the query, penalized by its
+// similarity to the results already picked. The results are compared by the
+// cosine similarity of their normalized embeddings whatever the metric of the
+// index, as the L2 and IP distances are not bounded. Near-duplicates and candidates
+// beyond the cap of their site are dropped. Without diversity, the relevance
+// order of the candidates is kept.
+func diversify(candidates []store.SearchHit, opts diversifyOptions) []store.SearchHit {
+	var vectors [][]float32
+	if opts.needsEmbeddings() {
+		vectors = make([][]float32, len(candidates))
+		for i, candidate := range candidates {
+			vectors[i] = normalizedVector(candidate.Embedding)
+		}
+	}
+
+	// maxSimilarity is the highest similarity of each candidate to the
+	// results picked so far, updated after each pick.
+	maxSimilarity := make([]float64, len(candidates))
+	remaining := make([]bool, len(candidates))
+	for i := range remaining {
+		remaining[i] = true
+	}
+	siteCounts := make(map[string]int)
+	results := make([]store.SearchHit, 0, len(candidates))
+	for {
+		best, bestScore := -1, math.Inf(-1)
+		for i, candidate := range candidates {
+			if !remaining[i] {
+				continue
+			}
+			if opts.maxPerSite > 0 && siteCounts[candidate.Site] >= opts.maxPerSite {
+				remaining[i] = false
+				continue
+			}
+			if opts.dedupThreshold > 0 && len(results) > 0 && maxSimilarity[i] >= opts.dedupThreshold {
+				remaining[i] = false
+				continue
+			}
+			score := (1-opts.diversity)*candidate.Score - opts.diversity*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			return results
+		}
+
+		remaining[best] = false
+		siteCounts[candidates[best].Site]++
+		results = append(results, candidates[best])
+		if vectors != nil {
+			for i := range candidates {
+				if remaining[i] {
+					maxSimilarity[i] = max(maxSimilarity[i], dot(vectors[i], vectors[best]))
+				}
+			}
+		}
+	}
+}
+
+// normalizedVector decodes a FLOAT32 embedding to a unit vector, so that the
+// cosine similarity of two vectors is their dot product.
+// Missing embeddings are decoded to an empty vector, similar to none.
+func normalizedVector(embedding []byte) []float32 {
+	vector := make([]float32, len(embedding)/4)
+	var norm float64
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(embedding[i*4:]))
+		norm += float64(vector[i]) * float64(vector[i])
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// dot returns the dot product of two vectors, zero when their dimensions differ.
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,105 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// embedding encodes the values as a FLOAT32 embedding.
+func embedding(values ...float32) []byte {
+	b := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+func TestDiversify(t *testing.T) {
+	// a and b are near-duplicates, c is a distinct story of the same site as
+	// a, and d is an unrelated story of another site.
+	candidates := []store.SearchHit{
+		{ID: "a", Site: "vsd.fr", Score: 0.9, Embedding: embedding(1, 0, 0)},
+		{ID: "b", Site: "public.fr", Score: 0.89, Embedding: embedding(0.99, 0.1, 0)},
+		{ID: "c", Site: "vsd.fr", Score: 0.8, Embedding: embedding(0.6, 0.8, 0)},
+		{ID: "d", Site: "public.fr", Score: 0.7, Embedding: embedding(0, 0, 1)},
+	}
+	testCases := []struct {
+		name        string
+		opts        diversifyOptions
+		expectedIDs []string
+	}{
+		{
+			name:        "MaxPerSite",
+			opts:        diversifyOptions{maxPerSite: 1},
+			expectedIDs: []string{"a", "b"},
+		},
+		{
+			name:        "Dedup",
+			opts:        diversifyOptions{dedupThreshold: 0.95},
+			expectedIDs: []string{"a", "c", "d"},
+		},
+		{
+			name:        "MMR",
+			opts:        diversifyOptions{diversity: 0.5},
+			expectedIDs: []string{"a", "d", "c", "b"},
+		},
+		{
+			name:        "MMRWithDedupAndMaxPerSite",
+			opts:        diversifyOptions{diversity: 0.5, dedupThreshold: 0.95, maxPerSite: 1},
+			expectedIDs: []string{"a", "d"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ids []string
+			for _, hit := range diversify(candidates, tc.opts) {
+				ids = append(ids, hit.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestSearchDiversify(t *testing.T) {
+	mockStore := &mockStore{searchResults: []store.SearchHit{
+		{ID: "a", Site: "vsd.fr", Score: 0.9},
+		{ID: "b", Site: "vsd.fr", Score: 0.8},
+		{ID: "c", Site: "public.fr", Score: 0.7},
+		{ID: "d", Site: "public.fr", Score: 0.6},
+		{ID: "e", Site: "public.fr", Score: 0.5},
+	}}
+	server := &Server{
+		store:            mockStore,
+		vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	response, err := server.Search(context.Background(), SearchRequest{Query: "query", Limit: 2, Offset: 1, MaxPerSite: 2})
+	require.NoError(t, err)
+
+	// The candidates are over-fetched from the first neighbour, without their
+	// embeddings as sites are capped only, and paginated once diversified.
+	assert.Equal(t, overfetchFactor*3, mockStore.lastK)
+	assert.Equal(t, store.SearchOptions{}, mockStore.lastOpts)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, "b", response.Results[0].ID)
+	assert.Equal(t, "c", response.Results[1].ID)
+
+	_, err = server.Search(context.Background(), SearchRequest{Query: "query", DedupThreshold: 0.9})
+	require.NoError(t, err)
+	assert.True(t, mockStore.lastOpts.WithEmbeddings)
+
+	_, err = server.Search(context.Background(), SearchRequest{Query: "query", Diversity: 1.5})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, CodeInvalidRequest, apiErr.Code)
+}
@@ -0,0 +1,154 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDocumentLength is the maximum number of characters of a normalized
+// search document.
+const maxDocumentLength = 4096
+
+// decodeQueryVector decodes a base64 FLOAT32 little-endian query embedding.
+// Its dimension is checked against the index by the store.
+func decodeQueryVector(encoded string) ([]byte, *APIError) {
+	embedding, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, newAPIError(CodeInvalidRequest, "Vector must be base64 encoded")
+	}
+	if len(embedding) == 0 || len(embedding)%4 != 0 {
+		return nil, newAPIError(CodeInvalidRequest, fmt.Sprintf("Vector must be FLOAT32 values, got %d bytes", len(embedding)))
+	}
+	for i := 0; i < len(embedding); i += 4 {
+		f := float64(math.Float32frombits(binary.LittleEndian.Uint32(embedding[i:])))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, newAPIError(CodeInvalidRequest, fmt.Sprintf("Vector value %d is not finite", i/4))
+		}
+	}
+	return embedding, nil
+}
+
+// chunkDocument splits a normalized document into chunks of whole words,
+// each estimated to at most maxQueryTokens tokens, so that no chunk is
+// truncated by the model. Words longer than a chunk make their own chunk.
+func chunkDocument(document string) ([]string, *APIError) {
+	if document == "" {
+		return nil, newAPIError(CodeEmptyQuery, "Document cannot be empty")
+	}
+	if length := utf8.RuneCountInString(document); length > maxDocumentLength {
+		return nil, newAPIError(CodeQueryTooLong, fmt.Sprintf("Document length %d exceeds the maximum of %d characters", length, maxDocumentLength))
+	}
+
+	var chunks []string
+	var chunk []string
+	tokens := 0
+	for _, word := range strings.Fields(document) {
+		wordTokens := estimateTokens(word)
+		if len(chunk) > 0 && tokens+wordTokens > maxQueryTokens {
+			chunks = append(chunks, strings.Join(chunk, " "))
+			chunk, tokens = nil, 0
+		}
+		chunk = append(chunk, word)
+		tokens += wordTokens
+	}
+	return append(chunks, strings.Join(chunk, " ")), nil
+}
+
+// meanPool averages FLOAT32 embeddings of the same dimension into a single
+// one, rescaled to their mean norm: the mean of unit vectors is shorter than
+// them, which changes its L2 and IP distances to the stored embeddings.
+func meanPool(embeddings [][]byte) ([]byte, error) {
+	if len(embeddings) == 1 {
+		return embeddings[0], nil
+	}
+	if len(embeddings) == 0 || len(embeddings[0])%4 != 0 {
+		return nil, fmt.Errorf("invalid embeddings to pool")
+	}
+	sum := make([]float64, len(embeddings[0])/4)
+	var meanNorm float64
+	for _, embedding := range embeddings {
+		if len(embedding) != len(embeddings[0]) {
+			return nil, fmt.Errorf("embeddings to pool have %d and %d bytes", len(embeddings[0]), len(embedding))
+		}
+		var norm float64
+		for i := range sum {
+			f := float64(math.Float32frombits(binary.LittleEndian.Uint32(embedding[i*4:])))
+			sum[i] += f
+			norm += f * f
+		}
+		meanNorm += math.Sqrt(norm) / float64(len(embeddings))
+	}
+	var sumNorm float64
+	for _, f := range sum {
+		sumNorm += f * f
+	}
+	// Opposite embeddings pool to the zero vector, which is kept.
+	scale := 0.0
+	if sumNorm > 0 {
+		scale = meanNorm / math.Sqrt(sumNorm)
+	}
+	pooled := make([]byte, 0, len(embeddings[0]))
+	for _, f := range sum {
+		pooled = binary.LittleEndian.AppendUint32(pooled, math.Float32bits(float32(f*scale)))
+	}
+	return pooled, nil
+}
+
+// embedQuery returns the query embedding of a planned search, once the
+// vectorizer call is admitted. The search is degraded to a text search, with
+// no embedding, when the circuit of the vectorizer is open.
+func (s *Server) embedQuery(ctx context.Context, plan *searchPlan) ([]byte, *APIError) {
+	if plan.embedding != nil {
+		return plan.embedding, nil
+	}
+	release, err := s.admission.admit(ctx)
+	if err != nil {
+		plan.logger.Warn("Query embedding not admitted", "error", err)
+		return nil, admissionError(err)
+	}
+	defer release()
+	embedding, err := plan.embed()
+	if errors.Is(err, errCircuitOpen) {
+		plan.logger.Warn("Vectorizer circuit open, falling back to a text search")
+		plan.degrade()
+		return nil, nil
+	}
+	if err != nil {
+		plan.logger.Error("Failed to generate query embedding", "error", err)
+		return nil, upstreamError(err, CodeEmbeddingUnavailable, "Failed to generate query embedding")
+	}
+	return embedding, nil
+}
+
+// embed returns the query embedding of a planned search: the requested
+// vector, or the embedding of its text, pooled over its chunks.
+func (p *searchPlan) embed() ([]byte, error) {
+	if p.embedding != nil {
+		return p.embedding, nil
+	}
+	if len(p.chunks) == 1 {
+		return p.variant.Vectorizer.Vectorize(p.chunks[0])
+	}
+	embeddings, err := p.variant.Vectorizer.VectorizeBatch(p.chunks)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(p.chunks) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(p.chunks), len(embeddings))
+	}
+	return meanPool(embeddings)
+}
+
+// degrade turns a planned search into a text search of its text in the
+// titles. The results are not reranked, as the reranker is usually served by
+// the vectorizer.
+func (p *searchPlan) degrade() {
+	p.degraded = true
+	p.rerank = false
+}
@@ -0,0 +1,190 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestDecodeQueryVector(t *testing.T) {
+	vector, apiErr := decodeQueryVector(base64.StdEncoding.EncodeToString(embedding(1, -0.5)))
+	require.Nil(t, apiErr)
+	assert.Equal(t, embedding(1, -0.5), vector)
+
+	for _, encoded := range []string{
+		"not base64!",
+		base64.StdEncoding.EncodeToString([]byte{1, 2, 3}),
+		base64.StdEncoding.EncodeToString(embedding(1, float32(math.NaN()))),
+		base64.StdEncoding.EncodeToString(embedding(float32(math.Inf(1)))),
+	} {
+		_, apiErr := decodeQueryVector(encoded)
+		require.NotNil(t, apiErr, encoded)
+		assert.Equal(t, CodeInvalidRequest, apiErr.Code)
+	}
+}
+
+func TestChunkDocument(t *testing.T) {
+	chunks, apiErr := chunkDocument("a short paragraph")
+	require.Nil(t, apiErr)
+	assert.Equal(t, []string{"a short paragraph"}, chunks)
+
+	// Each word is estimated to a token.
+	words := make([]string, 2*maxQueryTokens+1)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i%10)
+	}
+	chunks, apiErr = chunkDocument(strings.Join(words, " "))
+	require.Nil(t, apiErr)
+	require.Len(t, chunks, 3)
+	assert.Equal(t, strings.Join(words[:maxQueryTokens], " "), chunks[0])
+	assert.Equal(t, words[2*maxQueryTokens], chunks[2])
+	for _, chunk := range chunks {
+		assert.Nil(t, validateQuery(chunk))
+	}
+
+	_, apiErr = chunkDocument("")
+	require.NotNil(t, apiErr)
+	assert.Equal(t, CodeEmptyQuery, apiErr.Code)
+	_, apiErr = chunkDocument(strings.Repeat("a ", maxDocumentLength))
+	require.NotNil(t, apiErr)
+	assert.Equal(t, CodeQueryTooLong, apiErr.Code)
+}
+
+func TestMeanPool(t *testing.T) {
+	// The mean is rescaled to the norm of the embeddings.
+	pooled, err := meanPool([][]byte{embedding(3, 4), embedding(3, -4)})
+	require.NoError(t, err)
+	assert.Equal(t, embedding(5, 0), pooled)
+
+	pooled, err = meanPool([][]byte{embedding(1, 0), embedding(-1, 0)})
+	require.NoError(t, err)
+	assert.Equal(t, embedding(0, 0), pooled)
+
+	_, err = meanPool([][]byte{embedding(1, 0), embedding(1)})
+	assert.Error(t, err)
+}
+
+// chunkVectorizer embeds each text as a single value, its number of words.
+type chunkVectorizer struct {
+	batches [][]string
+}
+
+func (m *chunkVectorizer) Vectorize(text string) ([]byte, error) {
+	embeddings, err := m.VectorizeBatch([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (m *chunkVectorizer) VectorizeBatch(texts []string) ([][]byte, error) {
+	m.batches = append(m.batches, texts)
+	embeddings := make([][]byte, len(texts))
+	for i, text := range texts {
+		embeddings[i] = embedding(float32(len(strings.Fields(text))))
+	}
+	return embeddings, nil
+}
+
+func TestSearchVectorAndDocument(t *testing.T) {
+	vector := base64.StdEncoding.EncodeToString(embedding(0.25, 0.75))
+	document := strings.TrimSpace(strings.Repeat("word ", maxQueryTokens+maxQueryTokens/2))
+	testCases := []struct {
+		name              string
+		request           SearchRequest
+		searchErr         error
+		expectedEmbedding []byte
+		expectedBatches   [][]string
+		expectedCode      ErrorCode
+	}{
+		{
+			name:              "Query",
+			request:           SearchRequest{Query: "Some  Query"},
+			expectedEmbedding: embedding(2),
+			expectedBatches:   [][]string{{"some query"}},
+		},
+		{
+			name:              "Vector",
+			request:           SearchRequest{Vector: vector},
+			expectedEmbedding: embedding(0.25, 0.75),
+		},
+		{
+			// The document is embedded as the mean of its two chunks.
+			name:              "Document",
+			request:           SearchRequest{Document: " Word " + document},
+			expectedEmbedding: embedding(float32(maxQueryTokens+maxQueryTokens/2+1) / 2),
+			expectedBatches: [][]string{{
+				strings.TrimSpace(strings.Repeat("word ", maxQueryTokens)),
+				strings.TrimSpace(strings.Repeat("word ", maxQueryTokens/2+1)),
+			}},
+		},
+		{
+			name:         "QueryAndVector",
+			request:      SearchRequest{Query: "query", Vector: vector},
+			expectedCode: CodeInvalidRequest,
+		},
+		{
+			name:         "VectorAndDocument",
+			request:      SearchRequest{Vector: vector, Document: document},
+			expectedCode: CodeInvalidRequest,
+		},
+		{
+			name:         "InvalidVector",
+			request:      SearchRequest{Vector: "AAA"},
+			expectedCode: CodeInvalidRequest,
+		},
+		{
+			name:         "DimensionMismatch",
+			request:      SearchRequest{Vector: vector},
+			searchErr:    fmt.Errorf("%w: expected 384 dimensions", store.ErrDimensionMismatch),
+			expectedCode: CodeInvalidRequest,
+		},
+		{
+			name:         "DocumentTooLong",
+			request:      SearchRequest{Document: strings.Repeat("a", maxDocumentLength+1)},
+			expectedCode: CodeQueryTooLong,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			controlStore := &mockStore{searchResults: []store.SearchHit{{ID: "a", Title: "A"}}, searchErr: tc.searchErr}
+			vectorizer := &chunkVectorizer{}
+			server := &Server{
+				store:            controlStore,
+				vectorizerClient: vectorizer,
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts: Options{
+					// Vectors are searched with the control variant, unless
+					// requested otherwise.
+					Variants: []Variant{{Name: "other", Vectorizer: vectorizer, Store: &mockStore{}, Percent: 100}},
+				},
+			}
+			if tc.request.Vector == "" {
+				server.opts.Variants = nil
+			}
+
+			response, err := server.Search(context.Background(), tc.request)
+			if tc.expectedCode != "" {
+				var apiErr *APIError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, tc.expectedCode, apiErr.Code)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, controlVariant, response.Variant)
+			assert.Equal(t, 1, response.Count)
+			assert.Equal(t, tc.expectedEmbedding, controlStore.lastEmbedding)
+			assert.Equal(t, tc.expectedBatches, vectorizer.batches)
+		})
+	}
+}
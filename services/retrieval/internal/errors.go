@@ -0,0 +1,176 @@
+package retrieval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// ErrorCode is a machine-readable identifier of an API error.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest       ErrorCode = "invalid_request"
+	CodeEmptyQuery           ErrorCode = "empty_query"
+	CodeQueryTooLong         ErrorCode = "query_too_long"
+	CodeRequestTooLarge      ErrorCode = "request_too_large"
+	CodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+	CodeArticleNotFound      ErrorCode = "article_not_found"
+	CodeCollectionNotFound   ErrorCode = "collection_not_found"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeEmbeddingUnavailable ErrorCode = "embedding_unavailable"
+	CodeStoreUnavailable     ErrorCode = "store_unavailable"
+	CodeOverloaded           ErrorCode = "overloaded"
+	CodeTimeout              ErrorCode = "timeout"
+)
+
+// retryAfterSeconds is the delay suggested to clients on retryable errors.
+const retryAfterSeconds = 1
+
+// requestIDHeader is the header used to propagate the request ID.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern restricts the request IDs provided by the clients, which
+// are echoed in the response headers and the logs.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// APIError describes an error returned to API consumers.
+type APIError struct {
+	Code       ErrorCode `json:"code"`
+	Message    string    `json:"message"`
+	RequestID  string    `json:"request_id"`
+	Retryable  bool      `json:"retryable"`
+	RetryAfter int       `json:"retry_after,omitempty"`
+	status     int
+}
+
+// Error implements the error interface, for the callers of Server.Search.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ErrorResponse is the envelope of every error payload.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// newAPIError creates an APIError for the given code, deriving the HTTP status
+// and the retryability from it.
+func newAPIError(code ErrorCode, message string) *APIError {
+	apiErr := &APIError{Code: code, Message: message}
+	switch code {
+	case CodeInvalidRequest, CodeEmptyQuery:
+		apiErr.status = http.StatusBadRequest
+	case CodeQueryTooLong:
+		apiErr.status = http.StatusUnprocessableEntity
+	case CodeRequestTooLarge:
+		apiErr.status = http.StatusRequestEntityTooLarge
+	case CodeMethodNotAllowed:
+		apiErr.status = http.StatusMethodNotAllowed
+	case CodeArticleNotFound, CodeCollectionNotFound:
+		apiErr.status = http.StatusNotFound
+	case CodeUnauthorized:
+		apiErr.status = http.StatusUnauthorized
+	case CodeForbidden:
+		apiErr.status = http.StatusForbidden
+	case CodeRateLimited:
+		apiErr.status = http.StatusTooManyRequests
+		apiErr.Retryable = true
+		apiErr.RetryAfter = retryAfterSeconds
+	case CodeEmbeddingUnavailable:
+		apiErr.status = http.StatusBadGateway
+		apiErr.Retryable = true
+	case CodeStoreUnavailable, CodeOverloaded:
+		apiErr.status = http.StatusServiceUnavailable
+		apiErr.Retryable = true
+		apiErr.RetryAfter = retryAfterSeconds
+	case CodeTimeout:
+		apiErr.status = http.StatusGatewayTimeout
+		apiErr.Retryable = true
+	default:
+		apiErr.status = http.StatusInternalServerError
+	}
+	return apiErr
+}
+
+// upstreamError classifies an error returned by a dependency. Timeouts are
+// reported as such, any other failure is reported with the given code.
+func upstreamError(err error, code ErrorCode, message string) *APIError {
+	if isTimeout(err) {
+		return newAPIError(CodeTimeout, message)
+	}
+	return newAPIError(code, message)
+}
+
+// isTimeout reports whether the error is caused by a deadline being exceeded.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// writeError writes the error envelope as the response.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, apiErr *APIError) {
+	apiErr.RequestID = requestID(r)
+	w.Header().Set("Content-Type", "application/json")
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(apiErr.RetryAfter))
+	}
+	w.WriteHeader(apiErr.status)
+	if err := json.NewEncoder(w).Encode(ErrorResponse{Error: *apiErr}); err != nil {
+		s.logger.Error("Failed to encode error response", "error", err)
+	}
+}
+
+type requestIDKey struct{}
+
+// withRequestID ensures each request carries an ID, reusing the one provided
+// by the client if it matches requestIDPattern, and echoes it in the response
+// headers.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID attached to the request by withRequestID, falling
+// back to the one provided by the client if valid.
+func requestID(r *http.Request) string {
+	if id := requestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	if id := r.Header.Get(requestIDHeader); requestIDPattern.MatchString(id) {
+		return id
+	}
+	return ""
+}
+
+// requestIDFromContext returns the request ID attached to the context by
+// withRequestID, if any.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
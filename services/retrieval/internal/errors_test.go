@@ -0,0 +1,79 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAPIError(t *testing.T) {
+	testCases := []struct {
+		code              ErrorCode
+		expectedStatus    int
+		expectedRetryable bool
+	}{
+		{code: CodeInvalidRequest, expectedStatus: http.StatusBadRequest},
+		{code: CodeQueryTooLong, expectedStatus: http.StatusUnprocessableEntity},
+		{code: CodeMethodNotAllowed, expectedStatus: http.StatusMethodNotAllowed},
+		{code: CodeCollectionNotFound, expectedStatus: http.StatusNotFound},
+		{code: CodeForbidden, expectedStatus: http.StatusForbidden},
+		{code: CodeRateLimited, expectedStatus: http.StatusTooManyRequests, expectedRetryable: true},
+		{code: CodeEmbeddingUnavailable, expectedStatus: http.StatusBadGateway, expectedRetryable: true},
+		{code: CodeStoreUnavailable, expectedStatus: http.StatusServiceUnavailable, expectedRetryable: true},
+		{code: CodeOverloaded, expectedStatus: http.StatusServiceUnavailable, expectedRetryable: true},
+		{code: CodeTimeout, expectedStatus: http.StatusGatewayTimeout, expectedRetryable: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.code), func(t *testing.T) {
+			apiErr := newAPIError(tc.code, "message")
+			assert.Equal(t, tc.expectedStatus, apiErr.status)
+			assert.Equal(t, tc.expectedRetryable, apiErr.Retryable)
+		})
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	apiErr := upstreamError(errors.New("connection refused"), CodeStoreUnavailable, "Vector search failed")
+	assert.Equal(t, CodeStoreUnavailable, apiErr.Code)
+
+	apiErr = upstreamError(fmt.Errorf("search: %w", context.DeadlineExceeded), CodeStoreUnavailable, "Vector search failed")
+	assert.Equal(t, CodeTimeout, apiErr.Code)
+}
+
+func TestWithRequestID(t *testing.T) {
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	}))
+
+	// A request ID is generated when the client does not provide one.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search", nil))
+	assert.NotEmpty(t, seen)
+	assert.Equal(t, seen, w.Header().Get(requestIDHeader))
+
+	// The client provided request ID is kept.
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	req.Header.Set(requestIDHeader, "client-id")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, "client-id", seen)
+	assert.Equal(t, "client-id", w.Header().Get(requestIDHeader))
+
+	// Invalid request IDs are replaced.
+	for _, id := range []string{"client id\r\nX-Injected: 1", strings.Repeat("a", 65), "<script>"} {
+		req = httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.Header.Set(requestIDHeader, id)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Regexp(t, "^[0-9a-f]{16}$", seen, id)
+		assert.Equal(t, seen, w.Header().Get(requestIDHeader))
+	}
+}
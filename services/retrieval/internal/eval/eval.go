@@ -0,0 +1,160 @@
+// Package eval measures the relevance of the search against judged queries.
+package eval
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// Judgment is a query with the links judged relevant to it.
+type Judgment struct {
+	Query    string   `json:"query"`
+	Site     string   `json:"site,omitempty"`
+	Relevant []string `json:"relevant"`
+}
+
+// ReadJudgments reads judgments from JSONL, one judgment per line. Empty lines
+// are skipped.
+func ReadJudgments(r io.Reader) ([]Judgment, error) {
+	var judgments []Judgment
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var judgment Judgment
+		if err := json.Unmarshal([]byte(text), &judgment); err != nil {
+			return nil, fmt.Errorf("invalid judgment at line %d: %w", line, err)
+		}
+		if judgment.Query == "" || len(judgment.Relevant) == 0 {
+			return nil, fmt.Errorf("judgment at line %d must have a query and relevant links", line)
+		}
+		judgments = append(judgments, judgment)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read judgments: %w", err)
+	}
+	return judgments, nil
+}
+
+// Searcher returns the links of the k most relevant articles for a query.
+type Searcher interface {
+	Search(ctx context.Context, query, site string, k int) ([]string, error)
+}
+
+// Metrics are the relevance metrics of a query, or their means over a run.
+type Metrics struct {
+	NDCG   float64 `json:"ndcg"`
+	MRR    float64 `json:"mrr"`
+	Recall float64 `json:"recall"`
+}
+
+// QueryResult is the evaluation of a judged query.
+type QueryResult struct {
+	Query     string   `json:"query"`
+	Site      string   `json:"site,omitempty"`
+	Retrieved []string `json:"retrieved"`
+	Metrics
+}
+
+// Report is the evaluation of a run over all the judged queries.
+type Report struct {
+	K       int           `json:"k"`
+	Label   string        `json:"label,omitempty"`
+	Mean    Metrics       `json:"mean"`
+	Queries []QueryResult `json:"queries"`
+}
+
+// Run evaluates the searcher against the judgments, with the k first results
+// of each query. The run fails on the first search error, rather than
+// skewing the metrics.
+func Run(ctx context.Context, searcher Searcher, judgments []Judgment, k int, label string) (*Report, error) {
+	report := &Report{K: k, Label: label, Queries: make([]QueryResult, 0, len(judgments))}
+	for _, judgment := range judgments {
+		retrieved, err := searcher.Search(ctx, judgment.Query, judgment.Site, k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %q: %w", judgment.Query, err)
+		}
+		result := QueryResult{
+			Query:     judgment.Query,
+			Site:      judgment.Site,
+			Retrieved: retrieved,
+			Metrics:   Evaluate(retrieved, judgment.Relevant, k),
+		}
+		report.Queries = append(report.Queries, result)
+		report.Mean.NDCG += result.NDCG
+		report.Mean.MRR += result.MRR
+		report.Mean.Recall += result.Recall
+	}
+	if n := float64(len(report.Queries)); n > 0 {
+		report.Mean.NDCG /= n
+		report.Mean.MRR /= n
+		report.Mean.Recall /= n
+	}
+	return report, nil
+}
+
+// Evaluate computes the metrics of the k first retrieved links, with binary
+// relevance judgments. A link retrieved more than once, such as the link of
+// articles of different titles, only counts at its first rank.
+func Evaluate(retrieved, relevant []string, k int) Metrics {
+	judged := make(map[string]bool, len(relevant))
+	for _, link := range relevant {
+		judged[normalizeLink(link)] = true
+	}
+	retrieved = uniqueLinks(retrieved)
+	if len(retrieved) > k {
+		retrieved = retrieved[:k]
+	}
+
+	var metrics Metrics
+	var dcg float64
+	found := 0
+	for i, link := range retrieved {
+		if !judged[normalizeLink(link)] {
+			continue
+		}
+		found++
+		dcg += 1 / math.Log2(float64(i+2))
+		if metrics.MRR == 0 {
+			metrics.MRR = 1 / float64(i+1)
+		}
+	}
+
+	var idcg float64
+	for i := 0; i < min(len(judged), k); i++ {
+		idcg += 1 / math.Log2(float64(i+2))
+	}
+	if idcg > 0 {
+		metrics.NDCG = dcg / idcg
+	}
+	if len(judged) > 0 {
+		metrics.Recall = float64(found) / float64(len(judged))
+	}
+	return metrics
+}
+
+// uniqueLinks returns the links without their repetitions, in order.
+func uniqueLinks(links []string) []string {
+	seen := make(map[string]bool, len(links))
+	unique := make([]string, 0, len(links))
+	for _, link := range links {
+		if normalized := normalizeLink(link); !seen[normalized] {
+			seen[normalized] = true
+			unique = append(unique, link)
+		}
+	}
+	return unique
+}
+
+// normalizeLink ignores the trailing slash of links, which sites add inconsistently.
+func normalizeLink(link string) string {
+	return strings.TrimSuffix(link, "/")
+}
@@ -0,0 +1,169 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	testCases := []struct {
+		name      string
+		retrieved []string
+		relevant  []string
+		k         int
+		expected  Metrics
+	}{
+		{
+			name:      "PerfectRanking",
+			retrieved: []string{"a", "b", "c"},
+			relevant:  []string{"a", "b"},
+			k:         3,
+			expected:  Metrics{NDCG: 1, MRR: 1, Recall: 1},
+		},
+		{
+			name:      "NoRelevantResult",
+			retrieved: []string{"c", "d"},
+			relevant:  []string{"a"},
+			k:         2,
+			expected:  Metrics{},
+		},
+		{
+			name:      "RelevantAtSecondRank",
+			retrieved: []string{"c", "a"},
+			relevant:  []string{"a"},
+			k:         2,
+			expected:  Metrics{NDCG: 1 / math.Log2(3), MRR: 0.5, Recall: 1},
+		},
+		{
+			name:      "RelevantBeyondK",
+			retrieved: []string{"c", "d", "a"},
+			relevant:  []string{"a", "b"},
+			k:         2,
+			expected:  Metrics{},
+		},
+		{
+			name:      "PartialRecall",
+			retrieved: []string{"a", "c"},
+			relevant:  []string{"a", "b"},
+			k:         2,
+			expected:  Metrics{NDCG: 1 / (1 + 1/math.Log2(3)), MRR: 1, Recall: 0.5},
+		},
+		{
+			name:      "TrailingSlashIgnored",
+			retrieved: []string{"https://vsd.fr/a/"},
+			relevant:  []string{"https://vsd.fr/a"},
+			k:         1,
+			expected:  Metrics{NDCG: 1, MRR: 1, Recall: 1},
+		},
+		{
+			name:      "DuplicateLinkCountedOnce",
+			retrieved: []string{"a", "a/", "b"},
+			relevant:  []string{"a", "b"},
+			k:         3,
+			expected:  Metrics{NDCG: 1, MRR: 1, Recall: 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			metrics := Evaluate(tc.retrieved, tc.relevant, tc.k)
+			assert.InDelta(t, tc.expected.NDCG, metrics.NDCG, 1e-9)
+			assert.InDelta(t, tc.expected.MRR, metrics.MRR, 1e-9)
+			assert.InDelta(t, tc.expected.Recall, metrics.Recall, 1e-9)
+		})
+	}
+}
+
+func TestReadJudgments(t *testing.T) {
+	judgments, err := ReadJudgments(strings.NewReader(`{"query": "retraites", "relevant": ["a"]}
+
+{"query": "cannes", "site": "public.fr", "relevant": ["b", "c"]}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []Judgment{
+		{Query: "retraites", Relevant: []string{"a"}},
+		{Query: "cannes", Site: "public.fr", Relevant: []string{"b", "c"}},
+	}, judgments)
+
+	_, err = ReadJudgments(strings.NewReader(`{"query": "retraites"}`))
+	assert.ErrorContains(t, err, "line 1 must have a query and relevant links")
+
+	_, err = ReadJudgments(strings.NewReader("{\"query\": \"a\", \"relevant\": [\"a\"]}\nnot json"))
+	assert.ErrorContains(t, err, "invalid judgment at line 2")
+}
+
+// mockSearcher implements the Searcher interface for testing.
+type mockSearcher struct {
+	results map[string][]string
+	err     error
+}
+
+func (m *mockSearcher) Search(ctx context.Context, query, site string, k int) ([]string, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.results[query], nil
+}
+
+func TestRun(t *testing.T) {
+	judgments := []Judgment{
+		{Query: "q1", Relevant: []string{"a"}},
+		{Query: "q2", Relevant: []string{"b"}},
+	}
+	searcher := &mockSearcher{results: map[string][]string{
+		"q1": {"a", "c"},
+		"q2": {"c", "d"},
+	}}
+
+	report, err := Run(context.Background(), searcher, judgments, 2, "baseline")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.K)
+	assert.Equal(t, "baseline", report.Label)
+	require.Len(t, report.Queries, 2)
+	assert.Equal(t, []string{"a", "c"}, report.Queries[0].Retrieved)
+	assert.Equal(t, Metrics{NDCG: 0.5, MRR: 0.5, Recall: 0.5}, report.Mean)
+
+	_, err = Run(context.Background(), &mockSearcher{err: errors.New("vectorizer down")}, judgments, 2, "")
+	assert.ErrorContains(t, err, `failed to search "q1"`)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &Report{
+		K:    10,
+		Mean: Metrics{NDCG: 0.5, MRR: 0.5, Recall: 0.5},
+		Queries: []QueryResult{
+			{Query: "improved", Metrics: Metrics{}},
+			{Query: "regressed", Metrics: Metrics{NDCG: 1, MRR: 1, Recall: 1}},
+			{Query: "unchanged", Metrics: Metrics{NDCG: 1, MRR: 1, Recall: 1}},
+			{Query: "removed", Metrics: Metrics{}},
+		},
+	}
+	current := &Report{
+		K:    10,
+		Mean: Metrics{NDCG: 0.6, MRR: 0.5, Recall: 0.5},
+		Queries: []QueryResult{
+			{Query: "improved", Metrics: Metrics{NDCG: 1, MRR: 1, Recall: 1}},
+			{Query: "regressed", Metrics: Metrics{NDCG: 0.5, MRR: 0.5, Recall: 1}},
+			{Query: "unchanged", Metrics: Metrics{NDCG: 1, MRR: 1, Recall: 1}},
+		},
+	}
+
+	comparison := Compare(baseline, current)
+	assert.InDelta(t, 0.1, comparison.Delta.NDCG, 1e-9)
+	require.Len(t, comparison.Changed, 2)
+	assert.Equal(t, "regressed", comparison.Changed[0].Query, "regressions come first")
+	assert.Equal(t, -0.5, comparison.Changed[0].Delta.NDCG)
+	assert.Equal(t, "improved", comparison.Changed[1].Query)
+	assert.Equal(t, []string{"removed"}, comparison.Missing)
+
+	var table strings.Builder
+	require.NoError(t, WriteComparisonTable(&table, comparison))
+	assert.Contains(t, table.String(), "-0.500")
+	assert.Contains(t, table.String(), "removed")
+}
@@ -0,0 +1,94 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// QueryDiff compares the metrics of a query between a baseline and a run.
+type QueryDiff struct {
+	Query    string  `json:"query"`
+	Baseline Metrics `json:"baseline"`
+	Current  Metrics `json:"current"`
+	Delta    Metrics `json:"delta"`
+}
+
+// Comparison compares a run to a baseline run.
+type Comparison struct {
+	Baseline Metrics `json:"baseline"`
+	Current  Metrics `json:"current"`
+	Delta    Metrics `json:"delta"`
+	// Changed lists the queries whose metrics changed, regressions first.
+	Changed []QueryDiff `json:"changed"`
+	// Missing lists the queries of the baseline missing from the run.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Compare compares a run to a baseline run, matching their queries by text and site.
+func Compare(baseline, current *Report) *Comparison {
+	comparison := &Comparison{
+		Baseline: baseline.Mean,
+		Current:  current.Mean,
+		Delta:    subtract(current.Mean, baseline.Mean),
+	}
+
+	currentByQuery := make(map[string]QueryResult, len(current.Queries))
+	for _, result := range current.Queries {
+		currentByQuery[result.Site+"\x00"+result.Query] = result
+	}
+	for _, base := range baseline.Queries {
+		result, ok := currentByQuery[base.Site+"\x00"+base.Query]
+		if !ok {
+			comparison.Missing = append(comparison.Missing, base.Query)
+			continue
+		}
+		if result.Metrics == base.Metrics {
+			continue
+		}
+		comparison.Changed = append(comparison.Changed, QueryDiff{
+			Query:    base.Query,
+			Baseline: base.Metrics,
+			Current:  result.Metrics,
+			Delta:    subtract(result.Metrics, base.Metrics),
+		})
+	}
+	sort.SliceStable(comparison.Changed, func(i, j int) bool {
+		return comparison.Changed[i].Delta.NDCG < comparison.Changed[j].Delta.NDCG
+	})
+	return comparison
+}
+
+func subtract(a, b Metrics) Metrics {
+	return Metrics{NDCG: a.NDCG - b.NDCG, MRR: a.MRR - b.MRR, Recall: a.Recall - b.Recall}
+}
+
+// WriteTable writes the report as a human-readable table.
+func WriteTable(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "QUERY\tNDCG@%d\tMRR\tRECALL@%d\n", report.K, report.K)
+	for _, result := range report.Queries {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\n", result.Query, result.NDCG, result.MRR, result.Recall)
+	}
+	fmt.Fprintf(tw, "MEAN (%d queries)\t%.3f\t%.3f\t%.3f\n", len(report.Queries), report.Mean.NDCG, report.Mean.MRR, report.Mean.Recall)
+	return tw.Flush()
+}
+
+// WriteComparisonTable writes the comparison as a human-readable table.
+func WriteComparisonTable(w io.Writer, comparison *Comparison) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUERY\tNDCG\tΔNDCG\tMRR\tΔMRR\tRECALL\tΔRECALL")
+	for _, diff := range comparison.Changed {
+		writeDiffRow(tw, diff.Query, diff.Current, diff.Delta)
+	}
+	writeDiffRow(tw, fmt.Sprintf("MEAN (%d changed)", len(comparison.Changed)), comparison.Current, comparison.Delta)
+	for _, query := range comparison.Missing {
+		fmt.Fprintf(tw, "%s\tmissing from the run\n", query)
+	}
+	return tw.Flush()
+}
+
+func writeDiffRow(w io.Writer, label string, current, delta Metrics) {
+	fmt.Fprintf(w, "%s\t%.3f\t%+.3f\t%.3f\t%+.3f\t%.3f\t%+.3f\n", label, current.NDCG, delta.NDCG, current.MRR, delta.MRR, current.Recall, delta.Recall)
+}
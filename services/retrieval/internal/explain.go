@@ -0,0 +1,80 @@
+package retrieval
+
+import (
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// SearchExplanation details how a search was performed, for debugging.
+type SearchExplanation struct {
+	// Query is the query text after normalization, as embedded.
+	Query string `json:"query"`
+	// Candidates is the number of neighbours fetched from the index.
+	Candidates int `json:"candidates"`
+	// Timings are the durations of the stages of the search, in milliseconds.
+	Timings map[string]float64 `json:"timings_ms"`
+}
+
+// ResultExplanation details how a result was scored and ranked.
+type ResultExplanation struct {
+	// VectorRank is the 1-based rank of the result in the vector order.
+	VectorRank int `json:"vector_rank"`
+	// Distance is the raw distance of the index metric.
+	Distance float64 `json:"distance"`
+	// Similarity is the similarity derived from the distance.
+	Similarity float64 `json:"similarity"`
+	// Recency is the recency component of the score, when ranked by recency.
+	Recency *float64 `json:"recency,omitempty"`
+	// RerankScore is the relevance scored by the reranker, when reranked.
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+	// Text is the text embedded for the article, empty for the articles
+	// stored without it.
+	Text string `json:"text"`
+}
+
+// vectorHit is the position and similarity of a hit in the vector order,
+// before it is rescored and reordered.
+type vectorHit struct {
+	rank       int
+	similarity float64
+}
+
+// vectorHits indexes the hits of a vector search by article ID, the first
+// one having the given 1-based rank.
+func vectorHits(hits []store.SearchHit, firstRank int) map[string]vectorHit {
+	indexed := make(map[string]vectorHit, len(hits))
+	for i, hit := range hits {
+		indexed[hit.ID] = vectorHit{rank: firstRank + i, similarity: hit.Score}
+	}
+	return indexed
+}
+
+// stageTimer measures the durations of the consecutive stages of a search.
+type stageTimer struct {
+	timings map[string]float64
+	started time.Time
+	last    time.Time
+}
+
+func newStageTimer() *stageTimer {
+	now := time.Now()
+	return &stageTimer{timings: make(map[string]float64), started: now, last: now}
+}
+
+// lap records the duration of the stage ending now.
+func (t *stageTimer) lap(stage string) {
+	now := time.Now()
+	t.timings[stage] = milliseconds(now.Sub(t.last))
+	t.last = now
+}
+
+// total records the duration of the whole search and returns the timings.
+func (t *stageTimer) total() map[string]float64 {
+	t.timings["total"] = milliseconds(time.Since(t.started))
+	return t.timings
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
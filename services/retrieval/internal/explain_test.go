@@ -0,0 +1,112 @@
+package retrieval
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestSearchExplain(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		token          string
+		expectedStatus int
+		expectedRealm  string
+	}{
+		{
+			name:           "Admin",
+			body:           `{"query": "  Test  Query ", "explain": true}`,
+			token:          "secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "MissingToken",
+			body:           `{"query": "test query", "explain": true}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedRealm:  "admin",
+		},
+		{
+			name:           "InvalidToken",
+			body:           `{"query": "test query", "explain": true}`,
+			token:          "guess",
+			expectedStatus: http.StatusUnauthorized,
+			// Bearer tokens other than the admin one are API keys.
+			expectedRealm: "api",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store: &mockStore{searchResults: []store.SearchHit{
+					{ID: "a", Title: "A", Score: 0.9, Distance: 0.1, Text: "A. text", PublishedAt: time.Now().AddDate(-1, 0, 0)},
+					{ID: "b", Title: "B", Score: 0.8, Distance: 0.2, PublishedAt: time.Now()},
+				}},
+				vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts: Options{
+					AdminToken:    "secret",
+					Reranker:      &mockReranker{scores: map[string]float64{"A. text": 2, "B": 1}},
+					RecencyWeight: 0.5,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+			require.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedStatus != http.StatusOK {
+				assert.Equal(t, `Bearer realm="`+tc.expectedRealm+`"`, w.Header().Get("WWW-Authenticate"))
+				return
+			}
+
+			var response SearchResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			require.NotNil(t, response.Explain)
+			assert.Equal(t, "test query", response.Explain.Query)
+			assert.Equal(t, 2, response.Explain.Candidates)
+			for _, stage := range []string{"embedding", "vector_search", "recency", "rerank", "total"} {
+				assert.Contains(t, response.Explain.Timings, stage)
+			}
+
+			// b is ranked first by recency, and a back first by the reranker.
+			require.Len(t, response.Results, 2)
+			explain := response.Results[0].Explain
+			require.NotNil(t, explain)
+			assert.Equal(t, 1, explain.VectorRank)
+			assert.Equal(t, 0.1, explain.Distance)
+			assert.Equal(t, 0.9, explain.Similarity)
+			assert.Equal(t, "A. text", explain.Text)
+			require.NotNil(t, explain.Recency)
+			require.NotNil(t, explain.RerankScore)
+			assert.Equal(t, 2.0, *explain.RerankScore)
+			assert.Equal(t, 2, response.Results[1].Explain.VectorRank)
+		})
+	}
+}
+
+func TestSearchWithoutExplain(t *testing.T) {
+	server := &Server{
+		store:            &mockStore{searchResults: []store.SearchHit{{ID: "a", Title: "A"}}},
+		vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	w := httptest.NewRecorder()
+	server.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search?q=test", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "explain")
+}
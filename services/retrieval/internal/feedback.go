@@ -0,0 +1,110 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// eventTimeout bounds the logging of an analytics event, which is done in the
+// background of the request.
+const eventTimeout = 2 * time.Second
+
+// Feedback types accepted by the /feedback endpoint.
+const (
+	FeedbackClick      = "click"
+	FeedbackThumbsUp   = "thumbs_up"
+	FeedbackThumbsDown = "thumbs_down"
+)
+
+// EventLog records the searches and the feedback on their results for
+// analytics.
+type EventLog interface {
+	LogSearch(ctx context.Context, event store.SearchEvent) error
+	LogFeedback(ctx context.Context, event store.FeedbackEvent) error
+}
+
+// recordSearch logs the search in the background, without delaying the
+// response. Failures are only logged.
+func (s *Server) recordSearch(ctx context.Context, event store.SearchEvent) {
+	if s.opts.Events == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), eventTimeout)
+	go func() {
+		defer cancel()
+		if err := s.opts.Events.LogSearch(ctx, event); err != nil {
+			s.logger.Warn("Failed to log search", "error", err, "search_id", event.SearchID, "request_id", requestIDFromContext(ctx))
+		}
+	}()
+}
+
+// FeedbackRequest represents a feedback payload on a search.
+type FeedbackRequest struct {
+	// SearchID is the ID returned in the search response.
+	SearchID string `json:"search_id"`
+	// Type is one of click, thumbs_up and thumbs_down.
+	Type string `json:"type"`
+	// ResultID is the article the feedback is about. It is required for
+	// clicks, thumbs may be given to the whole search.
+	ResultID string `json:"result_id,omitempty"`
+	// Rank is the 1-based rank of the result in the search.
+	Rank int `json:"rank,omitempty"`
+}
+
+// handleFeedback handles the /feedback endpoint, recording a click or a
+// thumbs up or down against a search.
+func (s *Server) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeError(w, r, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	var req FeedbackRequest
+	if apiErr := decodeRequest(w, r, &req); apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	if req.SearchID == "" {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, "Search ID cannot be empty"))
+		return
+	}
+	switch req.Type {
+	case FeedbackClick:
+		if req.ResultID == "" {
+			s.writeError(w, r, newAPIError(CodeInvalidRequest, "Result ID is required for clicks"))
+			return
+		}
+	case FeedbackThumbsUp, FeedbackThumbsDown:
+	default:
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, "Type must be one of click, thumbs_up and thumbs_down"))
+		return
+	}
+	if req.Rank < 0 || req.Rank > maxLimit {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, fmt.Sprintf("Rank must be between 1 and %d", maxLimit)))
+		return
+	}
+
+	if s.opts.Events == nil {
+		// Feedback is accepted but dropped when analytics are disabled, so
+		// that clients do not depend on the setting.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	err := s.opts.Events.LogFeedback(r.Context(), store.FeedbackEvent{
+		SearchID: req.SearchID,
+		Type:     req.Type,
+		ResultID: req.ResultID,
+		Rank:     req.Rank,
+	})
+	if err != nil {
+		s.logger.Error("Failed to log feedback", "error", err, "search_id", req.SearchID, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to log feedback"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,183 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// mockEventLog implements the EventLog interface for testing.
+type mockEventLog struct {
+	searches chan store.SearchEvent
+	feedback []store.FeedbackEvent
+	err      error
+}
+
+func (m *mockEventLog) LogSearch(ctx context.Context, event store.SearchEvent) error {
+	err := m.err
+	m.searches <- event
+	return err
+}
+
+func (m *mockEventLog) LogFeedback(ctx context.Context, event store.FeedbackEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.feedback = append(m.feedback, event)
+	return nil
+}
+
+// nextSearch waits for the search logged in the background.
+func (m *mockEventLog) nextSearch(t *testing.T) store.SearchEvent {
+	t.Helper()
+	select {
+	case event := <-m.searches:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Search was not logged")
+		return store.SearchEvent{}
+	}
+}
+
+func TestSearchEvents(t *testing.T) {
+	events := &mockEventLog{searches: make(chan store.SearchEvent, 1)}
+	mockStore := &mockStore{searchResults: []store.SearchHit{{ID: "a"}, {ID: "b"}}}
+	server := &Server{
+		store:            mockStore,
+		vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		opts:             Options{Events: events},
+	}
+
+	response, err := server.Search(context.Background(), SearchRequest{Query: "Test  Query", Site: "example.com"})
+	require.NoError(t, err)
+	require.NotEmpty(t, response.SearchID)
+
+	event := events.nextSearch(t)
+	assert.Equal(t, response.SearchID, event.SearchID)
+	assert.Equal(t, "test query", event.Query)
+	assert.Equal(t, "example.com", event.Site)
+	assert.Equal(t, defaultLimit, event.Limit)
+	assert.Equal(t, controlVariant, event.Variant)
+	assert.Equal(t, []string{"a", "b"}, event.ResultIDs)
+	assert.Empty(t, event.Error)
+
+	// Failed searches are logged with their error code.
+	mockStore.searchErr = errors.New("connection refused")
+	_, err = server.Search(context.Background(), SearchRequest{Query: "Test Query"})
+	require.Error(t, err)
+	event = events.nextSearch(t)
+	assert.Equal(t, string(CodeStoreUnavailable), event.Error)
+	assert.Empty(t, event.ResultIDs)
+
+	// Failing to log does not fail the search.
+	mockStore.searchErr = nil
+	events.err = errors.New("connection refused")
+	_, err = server.Search(context.Background(), SearchRequest{Query: "Test Query"})
+	require.NoError(t, err)
+	events.nextSearch(t)
+}
+
+func TestHandleFeedback(t *testing.T) {
+	testCases := []struct {
+		name             string
+		method           string
+		body             string
+		events           *mockEventLog
+		expectedStatus   int
+		expectedFeedback []store.FeedbackEvent
+	}{
+		{
+			name:             "Click",
+			method:           http.MethodPost,
+			body:             `{"search_id": "abc", "type": "click", "result_id": "a", "rank": 2}`,
+			events:           &mockEventLog{},
+			expectedStatus:   http.StatusNoContent,
+			expectedFeedback: []store.FeedbackEvent{{SearchID: "abc", Type: FeedbackClick, ResultID: "a", Rank: 2}},
+		},
+		{
+			name:             "ThumbsDownOnSearch",
+			method:           http.MethodPost,
+			body:             `{"search_id": "abc", "type": "thumbs_down"}`,
+			events:           &mockEventLog{},
+			expectedStatus:   http.StatusNoContent,
+			expectedFeedback: []store.FeedbackEvent{{SearchID: "abc", Type: FeedbackThumbsDown}},
+		},
+		{
+			name:           "ClickWithoutResult",
+			method:         http.MethodPost,
+			body:           `{"search_id": "abc", "type": "click"}`,
+			events:         &mockEventLog{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "MissingSearchID",
+			method:         http.MethodPost,
+			body:           `{"type": "thumbs_up"}`,
+			events:         &mockEventLog{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "UnknownType",
+			method:         http.MethodPost,
+			body:           `{"search_id": "abc", "type": "like"}`,
+			events:         &mockEventLog{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "InvalidRank",
+			method:         http.MethodPost,
+			body:           `{"search_id": "abc", "type": "click", "result_id": "a", "rank": 101}`,
+			events:         &mockEventLog{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "MethodNotAllowed",
+			method:         http.MethodGet,
+			events:         &mockEventLog{},
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "LogError",
+			method:         http.MethodPost,
+			body:           `{"search_id": "abc", "type": "thumbs_up"}`,
+			events:         &mockEventLog{err: errors.New("connection refused")},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "AnalyticsDisabled",
+			method:         http.MethodPost,
+			body:           `{"search_id": "abc", "type": "thumbs_up"}`,
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:  &mockStore{},
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			if tc.events != nil {
+				server.opts.Events = tc.events
+			}
+
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, httptest.NewRequest(tc.method, "/feedback", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.events != nil {
+				assert.Equal(t, tc.expectedFeedback, tc.events.feedback)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package retrieval
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/vectorization"
+)
+
+const (
+	// defaultReadTimeout, defaultIdleTimeout and defaultMaxHeaderBytes are
+	// the settings of the HTTP server when not configured.
+	defaultReadTimeout    = 5 * time.Second
+	defaultIdleTimeout    = 60 * time.Second
+	defaultMaxHeaderBytes = 64 << 10
+	// writeTimeoutMargin is left to write the response of the slowest search,
+	// after its upstream calls timed out.
+	writeTimeoutMargin = 5 * time.Second
+)
+
+// HTTPConfig holds the settings of the HTTP server of the service.
+type HTTPConfig struct {
+	// BindAddress is the host or IP address the server listens on, every
+	// interface when empty.
+	BindAddress string
+	// ReadTimeout, WriteTimeout and IdleTimeout bound the reading of the
+	// requests, the writing of the responses and the keep-alive of the idle
+	// connections. They default to 5s, to the budget of the slowest search
+	// and to 60s when zero.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// MaxHeaderBytes caps the size of the request headers, 64KiB when zero.
+	MaxHeaderBytes int
+	// TLSCertFile and TLSKeyFile are the PEM certificate and key of the
+	// server, served over TLS when both are set. They are reloaded by
+	// ReloadCertificate.
+	TLSCertFile string
+	TLSKeyFile  string
+	// H2C serves HTTP/2 without TLS, to the clients with prior knowledge of
+	// it, such as load balancers and gRPC style clients.
+	H2C bool
+}
+
+func (c HTTPConfig) tls() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != ""
+}
+
+// withDefaults returns the settings with the defaults of the unset ones. The
+// default write timeout outlasts the searches whose upstream calls time out,
+// which get an error response rather than a closed connection.
+func (c HTTPConfig) withDefaults(searchBudget time.Duration) HTTPConfig {
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = defaultReadTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = searchBudget + writeTimeoutMargin
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = defaultIdleTimeout
+	}
+	if c.MaxHeaderBytes == 0 {
+		c.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	return c
+}
+
+// searchBudget returns the longest time a search waits for its upstream
+// calls: the admission and the call of the vectorizer, bounded by the
+// timeout of its client, then the admission and the budget of the reranking.
+func (o Options) searchBudget() time.Duration {
+	return 2*o.Admission.MaxQueueWait + vectorization.Timeout + o.rerankTimeout()
+}
+
+// validate checks the settings of the HTTP server.
+func (c HTTPConfig) validate() error {
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 || c.MaxHeaderBytes < 0 {
+		return fmt.Errorf("invalid HTTP timeouts %v, %v, %v or max header bytes %d", c.ReadTimeout, c.WriteTimeout, c.IdleTimeout, c.MaxHeaderBytes)
+	}
+	if c.tls() && (c.TLSCertFile == "" || c.TLSKeyFile == "") {
+		return fmt.Errorf("both the TLS certificate and key files are required")
+	}
+	if c.tls() && c.H2C {
+		return fmt.Errorf("h2c cannot be enabled along with TLS, which serves HTTP/2 already")
+	}
+	return nil
+}
+
+// certificateLoader holds the TLS certificate of the server, reloaded from its
+// files without restarting the server.
+type certificateLoader struct {
+	certFile, keyFile string
+	certificate       atomic.Pointer[tls.Certificate]
+}
+
+// newCertificateLoader loads the certificate of the server.
+func newCertificateLoader(certFile, keyFile string) (*certificateLoader, error) {
+	loader := &certificateLoader{certFile: certFile, keyFile: keyFile}
+	if err := loader.load(); err != nil {
+		return nil, err
+	}
+	return loader, nil
+}
+
+// load reads the certificate files, the previous certificate being kept when
+// they are invalid.
+func (l *certificateLoader) load() error {
+	certificate, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	l.certificate.Store(&certificate)
+	return nil
+}
+
+// getCertificate implements tls.Config.GetCertificate.
+func (l *certificateLoader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return l.certificate.Load(), nil
+}
+
+// newHTTPServer builds the HTTP server of the settings.
+func (s *Server) newHTTPServer(handler http.Handler) *http.Server {
+	cfg := s.opts.HTTP.withDefaults(s.opts.searchBudget())
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(cfg.H2C)
+	httpServer := &http.Server{
+		Addr:           net.JoinHostPort(cfg.BindAddress, s.serverPort),
+		Handler:        handler,
+		ReadTimeout:    cfg.ReadTimeout,
+		WriteTimeout:   cfg.WriteTimeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+		Protocols:      protocols,
+	}
+	if s.certificates != nil {
+		httpServer.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certificates.getCertificate,
+		}
+	}
+	return httpServer
+}
+
+// ReloadCertificate reloads the TLS certificate of the server from its files,
+// for the new connections. The current certificate is kept on failure, and
+// nothing is done when TLS is disabled.
+func (s *Server) ReloadCertificate() error {
+	if s.certificates == nil {
+		return nil
+	}
+	return s.certificates.load()
+}
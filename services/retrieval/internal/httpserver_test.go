@@ -0,0 +1,138 @@
+package retrieval
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/vectorization"
+)
+
+// writeCertificate writes a self-signed certificate and its key to a
+// directory, and returns their paths.
+func writeCertificate(t *testing.T, dir string, serial int64) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func TestHTTPConfigValidate(t *testing.T) {
+	assert.NoError(t, HTTPConfig{}.validate())
+	assert.NoError(t, HTTPConfig{ReadTimeout: time.Second, TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}.validate())
+	assert.NoError(t, HTTPConfig{H2C: true}.validate())
+	assert.Error(t, HTTPConfig{WriteTimeout: -time.Second}.validate())
+	assert.Error(t, HTTPConfig{MaxHeaderBytes: -1}.validate())
+	assert.Error(t, HTTPConfig{TLSCertFile: "cert.pem"}.validate())
+	assert.Error(t, HTTPConfig{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", H2C: true}.validate())
+}
+
+func TestServerTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, 1)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := HTTPConfig{
+		BindAddress:    "127.0.0.1",
+		ReadTimeout:    time.Second,
+		WriteTimeout:   2 * time.Second,
+		IdleTimeout:    3 * time.Second,
+		MaxHeaderBytes: 4096,
+		TLSCertFile:    certFile,
+		TLSKeyFile:     keyFile,
+	}
+
+	_, err := New("8443", &mockStore{}, &mockVectorizer{}, logger, Options{HTTP: HTTPConfig{TLSCertFile: certFile, TLSKeyFile: filepath.Join(dir, "missing.pem")}})
+	require.Error(t, err)
+
+	server, err := New("8443", &mockStore{}, &mockVectorizer{}, logger, Options{HTTP: cfg})
+	require.NoError(t, err)
+	httpServer := server.newHTTPServer(server.routes())
+	assert.Equal(t, "127.0.0.1:8443", httpServer.Addr)
+	assert.Equal(t, time.Second, httpServer.ReadTimeout)
+	assert.Equal(t, 2*time.Second, httpServer.WriteTimeout)
+	assert.Equal(t, 3*time.Second, httpServer.IdleTimeout)
+	assert.Equal(t, 4096, httpServer.MaxHeaderBytes)
+
+	serial := func() int64 {
+		certificate, err := httpServer.TLSConfig.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		require.NoError(t, err)
+		return leaf.SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(1), serial())
+
+	// The renewed certificate is served once reloaded, and the current one is
+	// kept when the files are invalid.
+	writeCertificate(t, dir, 2)
+	assert.Equal(t, int64(1), serial())
+	require.NoError(t, server.ReloadCertificate())
+	assert.Equal(t, int64(2), serial())
+	require.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	assert.Error(t, server.ReloadCertificate())
+	assert.Equal(t, int64(2), serial())
+}
+
+func TestServerH2C(t *testing.T) {
+	server, err := New("0", &mockStore{}, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{HTTP: HTTPConfig{H2C: true}})
+	require.NoError(t, err)
+	require.NoError(t, server.ReloadCertificate())
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer := server.newHTTPServer(server.routes())
+	go func() { _ = httpServer.Serve(listener) }()
+	defer httpServer.Close()
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	resp, err := client.Get("http://" + listener.Addr().String() + "/health")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+}
+
+func TestHTTPConfigDefaults(t *testing.T) {
+	server, err := New("8080", &mockStore{}, &mockVectorizer{}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+		Admission:     Admission{MaxConcurrent: 1, MaxQueueWait: time.Second},
+		RerankTimeout: 2 * time.Second,
+	})
+	require.NoError(t, err)
+	httpServer := server.newHTTPServer(server.routes())
+	assert.Equal(t, 5*time.Second, httpServer.ReadTimeout)
+	assert.Equal(t, 60*time.Second, httpServer.IdleTimeout)
+	assert.Equal(t, 64<<10, httpServer.MaxHeaderBytes)
+	// The write timeout outlasts the admission and the call of the
+	// vectorizer, then the admission and the budget of the reranking.
+	assert.Equal(t, 2*time.Second+vectorization.Timeout+2*time.Second+writeTimeoutMargin, httpServer.WriteTimeout)
+}
@@ -0,0 +1,149 @@
+package retrieval
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/segmentio/encoding/json"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// maxRequestBodyBytes caps the size of the search request payloads.
+	maxRequestBodyBytes = 16 << 10
+	// maxQueryLength is the maximum number of characters of a normalized query.
+	maxQueryLength = 512
+	// maxQueryTokens is the maximum number of tokens estimated for a normalized
+	// query. It stays well below the max sequence length of the default model.
+	maxQueryTokens = 128
+	// charsPerToken is the average number of characters per token used to
+	// estimate the number of tokens of a query.
+	charsPerToken = 4
+)
+
+// decodeRequest decodes the JSON body of the request into v. The body size is
+// capped and unknown fields are rejected.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v any) *APIError {
+	return decodeRequestLimit(w, r, v, maxRequestBodyBytes)
+}
+
+// decodeRequestLimit decodes the JSON body of the request into v as
+// decodeRequest does, with a body capped to maxBytes.
+func decodeRequestLimit(w http.ResponseWriter, r *http.Request, v any, maxBytes int64) *APIError {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return newAPIError(CodeRequestTooLarge, fmt.Sprintf("Request body exceeds %d bytes", maxBytesErr.Limit))
+		}
+		if strings.Contains(err.Error(), "unknown field") {
+			return newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		}
+		return newAPIError(CodeInvalidRequest, "Invalid request body")
+	}
+	return nil
+}
+
+// parseSearchParams reads the search request from the query string parameters.
+func parseSearchParams(params url.Values, req *SearchRequest) *APIError {
+	req.Query = params.Get("q")
+	req.Vector = params.Get("vector")
+	req.Document = params.Get("document")
+	req.Collection = params.Get("collection")
+	req.Site = params.Get("site")
+	req.Variant = params.Get("variant")
+	req.RecencyHalfLife = params.Get("recency_half_life")
+	for name, dst := range map[string]*int{"limit": &req.Limit, "offset": &req.Offset, "ef_runtime": &req.EFRuntime, "max_per_site": &req.MaxPerSite} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid %s %q", name, value))
+		}
+		*dst = n
+	}
+	for name, dst := range map[string]*float64{"min_score": &req.MinScore, "diversity": &req.Diversity, "dedup_threshold": &req.DedupThreshold} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid %s %q", name, value))
+		}
+		*dst = f
+	}
+	if value := params.Get("recency_weight"); value != "" {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid recency_weight %q", value))
+		}
+		req.RecencyWeight = &weight
+	}
+	for name, dst := range map[string]*bool{"with_distance": &req.WithDistance, "explain": &req.Explain} {
+		value := params.Get(name)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid %s %q", name, value))
+		}
+		*dst = b
+	}
+	return nil
+}
+
+// normalizeQuery normalizes a query before its vectorization:
+//   - Unicode compatibility characters are folded (NFKC),
+//   - control and invisible format characters are removed,
+//   - whitespace sequences are collapsed into a single space and trimmed,
+//   - the text is lowercased, as the default model is uncased.
+func normalizeQuery(query string) string {
+	query = norm.NFKC.String(query)
+	query = strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r):
+			return -1
+		}
+		return r
+	}, query)
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// validateQuery checks that a normalized query can be vectorized.
+func validateQuery(query string) *APIError {
+	if query == "" {
+		return newAPIError(CodeEmptyQuery, "Query cannot be empty")
+	}
+	if length := utf8.RuneCountInString(query); length > maxQueryLength {
+		return newAPIError(CodeQueryTooLong, fmt.Sprintf("Query length %d exceeds the maximum of %d characters", length, maxQueryLength))
+	}
+	if tokens := estimateTokens(query); tokens > maxQueryTokens {
+		return newAPIError(CodeQueryTooLong, fmt.Sprintf("Query is estimated to %d tokens, exceeding the maximum of %d", tokens, maxQueryTokens))
+	}
+	return nil
+}
+
+// estimateTokens roughly estimates the number of tokens of a text: each word
+// accounts for at least one token, long words are split every charsPerToken
+// characters.
+func estimateTokens(text string) int {
+	tokens := 0
+	for _, word := range strings.Fields(text) {
+		tokens += (utf8.RuneCountInString(word) + charsPerToken - 1) / charsPerToken
+	}
+	return tokens
+}
@@ -0,0 +1,56 @@
+package retrieval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "Unchanged", query: "élection présidentielle", expected: "élection présidentielle"},
+		{name: "Lowercase", query: "Élection PRÉSIDENTIELLE", expected: "élection présidentielle"},
+		{name: "CollapseWhitespace", query: "  élection \t\n présidentielle  ", expected: "élection présidentielle"},
+		{name: "DecomposedAccents", query: "e\u0301lection", expected: "élection"},
+		{name: "CompatibilityCharacters", query: "ﬁlm ＴＶ", expected: "film tv"},
+		{name: "InvisibleCharacters", query: "pré\u200bsident\u0000", expected: "président"},
+		{name: "Empty", query: "   ", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, normalizeQuery(tc.query))
+		})
+	}
+}
+
+func TestValidateQuery(t *testing.T) {
+	testCases := []struct {
+		name         string
+		query        string
+		expectedCode ErrorCode
+	}{
+		{name: "Valid", query: "élection présidentielle"},
+		{name: "Empty", query: "", expectedCode: CodeEmptyQuery},
+		{name: "TooLong", query: strings.Repeat("a", maxQueryLength+1), expectedCode: CodeQueryTooLong},
+		{name: "TooManyTokens", query: strings.Repeat("a ", maxQueryTokens) + "a", expectedCode: CodeQueryTooLong},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			apiErr := validateQuery(tc.query)
+			if tc.expectedCode == "" {
+				assert.Nil(t, apiErr)
+				return
+			}
+			if assert.NotNil(t, apiErr) {
+				assert.Equal(t, tc.expectedCode, apiErr.Code)
+			}
+		})
+	}
+}
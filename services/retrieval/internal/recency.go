@@ -0,0 +1,87 @@
+package retrieval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// defaultRecencyHalfLife is the age at which the recency of an article is
+// halved, when not configured.
+const defaultRecencyHalfLife = 30 * 24 * time.Hour
+
+// recencyOptions holds the recency ranking settings of a search.
+type recencyOptions struct {
+	// weight is the share of the recency in the score, from 0 (similarity
+	// only) to 1 (recency only).
+	weight float64
+	// halfLife is the age at which the recency of an article is halved.
+	halfLife time.Duration
+}
+
+// enabled reports whether the results are ranked by recency.
+func (o recencyOptions) enabled() bool {
+	return o.weight > 0
+}
+
+// scoreComponents are the components of the score of a result ranked by
+// recency.
+type scoreComponents struct {
+	similarity float64
+	recency    float64
+}
+
+// recencyOptions returns the recency settings of the request, falling back to
+// the configured ones.
+func (s *Server) recencyOptions(req *SearchRequest) (recencyOptions, *APIError) {
+	opts := recencyOptions{weight: s.opts.RecencyWeight, halfLife: s.opts.RecencyHalfLife}
+	if req.RecencyWeight != nil {
+		opts.weight = *req.RecencyWeight
+	}
+	if req.RecencyHalfLife != "" {
+		halfLife, err := time.ParseDuration(req.RecencyHalfLife)
+		if err != nil || halfLife <= 0 {
+			return opts, newAPIError(CodeInvalidRequest, fmt.Sprintf("Invalid recency half-life %q, expected a positive duration such as 168h", req.RecencyHalfLife))
+		}
+		opts.halfLife = halfLife
+	}
+	if opts.halfLife <= 0 {
+		opts.halfLife = defaultRecencyHalfLife
+	}
+	if !(opts.weight >= 0 && opts.weight <= 1) {
+		return opts, newAPIError(CodeInvalidRequest, "Recency weight must be between 0 and 1")
+	}
+	return opts, nil
+}
+
+// recencyScore decays exponentially with the age of the article, from 1 for
+// the articles published now. Articles without publish date score 0.
+func recencyScore(publishedAt, now time.Time, halfLife time.Duration) float64 {
+	if publishedAt.IsZero() {
+		return 0
+	}
+	age := max(now.Sub(publishedAt), 0)
+	return math.Exp2(-float64(age) / float64(halfLife))
+}
+
+// rankByRecency replaces the score of the hits by the weighted sum of their
+// similarity and recency, and sorts them by decreasing score. The components
+// of the scores are returned by article ID.
+func rankByRecency(hits []store.SearchHit, opts recencyOptions, now time.Time) map[string]scoreComponents {
+	components := make(map[string]scoreComponents, len(hits))
+	for i := range hits {
+		c := scoreComponents{
+			similarity: hits[i].Score,
+			recency:    recencyScore(hits[i].PublishedAt, now, opts.halfLife),
+		}
+		components[hits[i].ID] = c
+		hits[i].Score = (1-opts.weight)*c.similarity + opts.weight*c.recency
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	return components
+}
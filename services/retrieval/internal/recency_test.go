@@ -0,0 +1,114 @@
+package retrieval
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestRecencyScore(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	halfLife := 30 * 24 * time.Hour
+
+	assert.Equal(t, 1.0, recencyScore(now, now, halfLife))
+	assert.Equal(t, 1.0, recencyScore(now.Add(time.Hour), now, halfLife))
+	assert.InDelta(t, 0.5, recencyScore(now.Add(-halfLife), now, halfLife), 1e-9)
+	assert.InDelta(t, 0.25, recencyScore(now.Add(-2*halfLife), now, halfLife), 1e-9)
+	assert.Zero(t, recencyScore(time.Time{}, now, halfLife))
+}
+
+func TestSearchRecency(t *testing.T) {
+	now := time.Now()
+	hits := func() []store.SearchHit {
+		return []store.SearchHit{
+			{ID: "old", Score: 0.9, PublishedAt: now.AddDate(-2, 0, 0)},
+			{ID: "recent", Score: 0.85, PublishedAt: now.Add(-24 * time.Hour)},
+			{ID: "undated", Score: 0.8},
+		}
+	}
+	weight := 0.5
+	noWeight := 0.0
+	testCases := []struct {
+		name          string
+		opts          Options
+		request       SearchRequest
+		expectedIDs   []string
+		expectRecency bool
+		expectedCode  ErrorCode
+	}{
+		{
+			name:        "Disabled",
+			request:     SearchRequest{Query: "query"},
+			expectedIDs: []string{"old", "recent", "undated"},
+		},
+		{
+			name:          "Configured",
+			opts:          Options{RecencyWeight: 0.3},
+			request:       SearchRequest{Query: "query"},
+			expectedIDs:   []string{"recent", "old", "undated"},
+			expectRecency: true,
+		},
+		{
+			name:          "RequestWeight",
+			request:       SearchRequest{Query: "query", RecencyWeight: &weight, RecencyHalfLife: "168h"},
+			expectedIDs:   []string{"recent", "old", "undated"},
+			expectRecency: true,
+		},
+		{
+			name:        "RequestDisabled",
+			opts:        Options{RecencyWeight: 0.3},
+			request:     SearchRequest{Query: "query", RecencyWeight: &noWeight},
+			expectedIDs: []string{"old", "recent", "undated"},
+		},
+		{
+			name:         "InvalidHalfLife",
+			request:      SearchRequest{Query: "query", RecencyWeight: &weight, RecencyHalfLife: "a week"},
+			expectedCode: CodeInvalidRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStore := &mockStore{searchResults: hits()}
+			server := &Server{
+				store:            mockStore,
+				vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts:             tc.opts,
+			}
+
+			response, err := server.Search(context.Background(), tc.request)
+			if tc.expectedCode != "" {
+				var apiErr *APIError
+				require.ErrorAs(t, err, &apiErr)
+				assert.Equal(t, tc.expectedCode, apiErr.Code)
+				return
+			}
+			require.NoError(t, err)
+
+			var ids []string
+			for _, result := range response.Results {
+				ids = append(ids, result.ID)
+				if !tc.expectRecency {
+					assert.Nil(t, result.Similarity)
+					assert.Nil(t, result.Recency)
+					continue
+				}
+				require.NotNil(t, result.Similarity)
+				require.NotNil(t, result.Recency)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			if tc.expectRecency {
+				assert.Equal(t, 0.85, *response.Results[0].Similarity)
+				assert.Zero(t, *response.Results[2].Recency)
+				assert.Equal(t, overfetchFactor*defaultLimit, mockStore.lastK)
+			}
+		})
+	}
+}
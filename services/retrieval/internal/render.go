@@ -0,0 +1,240 @@
+package retrieval
+
+import (
+	"encoding/xml"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/encoding/json"
+)
+
+// responseFormat is a representation of the search response.
+type responseFormat string
+
+const (
+	formatJSON responseFormat = "application/json"
+	formatHTML responseFormat = "text/html"
+	formatAtom responseFormat = "application/atom+xml"
+	formatRSS  responseFormat = "application/rss+xml"
+)
+
+// supportedFormats lists the response formats, by order of preference.
+var supportedFormats = []responseFormat{formatJSON, formatHTML, formatAtom, formatRSS}
+
+// negotiateFormat picks the response format best matching the Accept header.
+// JSON is used when the header is missing or matches no supported format.
+func negotiateFormat(accept string) responseFormat {
+	if accept == "" {
+		return formatJSON
+	}
+
+	best, bestQuality := formatJSON, 0.0
+	for _, format := range supportedFormats {
+		if quality := acceptQuality(accept, string(format)); quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the quality factor given to a media type by the Accept
+// header. The most specific matching media range is used.
+func acceptQuality(accept, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		rangeType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+
+		var rangeSpecificity int
+		switch rangeType {
+		case mediaType:
+			rangeSpecificity = 2
+		case mainType + "/*":
+			rangeSpecificity = 1
+		case "*/*":
+			rangeSpecificity = 0
+		default:
+			continue
+		}
+		if rangeSpecificity <= specificity {
+			continue
+		}
+
+		specificity, quality = rangeSpecificity, 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+	}
+	return quality
+}
+
+// writeSearchResponse writes the search response in the given format.
+// A nil response is rendered as an empty search page.
+func (s *Server) writeSearchResponse(w http.ResponseWriter, r *http.Request, format responseFormat, req SearchRequest, response *SearchResponse) {
+	w.Header().Set("Vary", "Accept")
+
+	var err error
+	switch format {
+	case formatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = searchPage.Execute(w, searchPageData{Request: req, Response: response})
+	case formatAtom:
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		err = writeXML(w, newAtomFeed(requestURL(r), req, response))
+	case formatRSS:
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		err = writeXML(w, newRSSFeed(requestURL(r), req, response))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(response)
+	}
+	if err != nil {
+		s.logger.Error("Failed to encode search response", "error", err, "format", format)
+	}
+}
+
+// requestURL rebuilds the absolute URL of the request.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+type searchPageData struct {
+	Request  SearchRequest
+	Response *SearchResponse
+}
+
+var searchPage = template.Must(template.New("search").Parse(`<!DOCTYPE html>
+<html lang="fr">
+<head>
+<meta charset="utf-8">
+<title>{{if .Request.Query}}{{.Request.Query}} - {{end}}GS Search</title>
+</head>
+<body>
+<form action="/search" method="get">
+<input type="search" name="q" value="{{.Request.Query}}" autofocus>
+{{if .Request.Site}}<input type="hidden" name="site" value="{{.Request.Site}}">{{end}}
+<button type="submit">Search</button>
+</form>
+{{with .Response}}
+<p>{{.Count}} results</p>
+<ol>
+{{range .Results}}<li><a href="{{.URL}}">{{.Title}}</a> <small>{{.Site}}{{with .PublishedAt}} {{.Format "02/01/2006"}}{{end}} ({{printf "%.3f" .Score}})</small></li>
+{{end}}</ol>
+{{end}}
+</body>
+</html>
+`))
+
+func writeXML(w http.ResponseWriter, v any) error {
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// newAtomFeed builds an Atom feed of the search results.
+// The feed generation time is used for articles without publication date.
+func newAtomFeed(selfURL string, req SearchRequest, response *SearchResponse) atomFeed {
+	now := time.Now().UTC()
+	feed := atomFeed{
+		ID:      selfURL,
+		Title:   "GS Search: " + req.Query,
+		Link:    atomLink{Href: selfURL, Rel: "self"},
+		Updated: now.Format(time.RFC3339),
+	}
+	for _, result := range response.Results {
+		updated := now
+		if result.PublishedAt != nil {
+			updated = *result.PublishedAt
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      result.URL,
+			Title:   result.Title,
+			Link:    atomLink{Href: result.URL},
+			Updated: updated.Format(time.RFC3339),
+			Summary: result.Site,
+		})
+	}
+	return feed
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate,omitempty"`
+	Description string `xml:"description,omitempty"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+// newRSSFeed builds a RSS 2.0 feed of the search results.
+func newRSSFeed(selfURL string, req SearchRequest, response *SearchResponse) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       "GS Search: " + req.Query,
+			Link:        selfURL,
+			Description: "Search results for " + req.Query,
+		},
+	}
+	for _, result := range response.Results {
+		item := rssItem{
+			Title:       result.Title,
+			Link:        result.URL,
+			GUID:        result.URL,
+			Description: result.Site,
+		}
+		if result.PublishedAt != nil {
+			item.PubDate = result.PublishedAt.Format(time.RFC1123Z)
+		}
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+	return feed
+}
@@ -0,0 +1,117 @@
+package retrieval
+
+import (
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		accept   string
+		expected responseFormat
+	}{
+		{name: "Missing", accept: "", expected: formatJSON},
+		{name: "Any", accept: "*/*", expected: formatJSON},
+		{name: "JSON", accept: "application/json", expected: formatJSON},
+		{name: "Browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", expected: formatHTML},
+		{name: "Atom", accept: "application/atom+xml", expected: formatAtom},
+		{name: "RSS", accept: "application/rss+xml, application/xml;q=0.9", expected: formatRSS},
+		{name: "Quality", accept: "application/json;q=0.5, text/html", expected: formatHTML},
+		{name: "Unsupported", accept: "image/png", expected: formatJSON},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, negotiateFormat(tc.accept))
+		})
+	}
+}
+
+func TestHandleSearchFormats(t *testing.T) {
+	hits := []store.SearchHit{
+		{Title: "Résultat <1>", Link: "http://vsd.fr/1", Site: "vsd.fr", Score: 0.12},
+	}
+
+	testCases := []struct {
+		name                string
+		url                 string
+		accept              string
+		expectedContentType string
+		expectedContains    []string
+		expectedNotContains []string
+	}{
+		{
+			name:                "HTML",
+			url:                 "/search?q=test",
+			accept:              "text/html",
+			expectedContentType: "text/html; charset=utf-8",
+			expectedContains:    []string{`value="test"`, `<a href="http://vsd.fr/1">Résultat &lt;1&gt;</a>`, "0.120"},
+		},
+		{
+			name:                "HTMLEmptyQuery",
+			url:                 "/search",
+			accept:              "text/html",
+			expectedContentType: "text/html; charset=utf-8",
+			expectedContains:    []string{`<form action="/search" method="get">`},
+			expectedNotContains: []string{"vsd.fr/1"},
+		},
+		{
+			name:                "Atom",
+			url:                 "/search?q=test",
+			accept:              "application/atom+xml",
+			expectedContentType: "application/atom+xml; charset=utf-8",
+			expectedContains:    []string{`<feed xmlns="http://www.w3.org/2005/Atom">`, `<link href="http://vsd.fr/1"></link>`},
+		},
+		{
+			name:                "RSS",
+			url:                 "/search?q=test",
+			accept:              "application/rss+xml",
+			expectedContentType: "application/rss+xml; charset=utf-8",
+			expectedContains:    []string{`<rss version="2.0">`, "<link>http://vsd.fr/1</link>"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:            &mockStore{searchResults: hits},
+				vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			req.Header.Set("Accept", tc.accept)
+			w := httptest.NewRecorder()
+			server.handleSearch(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.expectedContentType, w.Header().Get("Content-Type"))
+			body := w.Body.String()
+			for _, expected := range tc.expectedContains {
+				assert.Contains(t, body, expected)
+			}
+			for _, notExpected := range tc.expectedNotContains {
+				assert.NotContains(t, body, notExpected)
+			}
+			switch tc.accept {
+			case "application/atom+xml":
+				var feed atomFeed
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+				assert.Len(t, feed.Entries, len(hits))
+			case "application/rss+xml":
+				var feed rssFeed
+				require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &feed))
+				assert.Len(t, feed.Channel.Items, len(hits))
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+const (
+	// defaultRerankCandidates is the number of nearest neighbours reranked
+	// when not configured.
+	defaultRerankCandidates = 50
+	// defaultRerankTimeout is the reranking budget when not configured.
+	defaultRerankTimeout = 300 * time.Millisecond
+)
+
+// Reranker scores the relevance of documents to a query, more finely than
+// the distance between their embeddings.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// rerankCandidates returns the number of nearest neighbours to rerank.
+func (s *Server) rerankCandidates() int {
+	if s.opts.RerankCandidates > 0 {
+		return s.opts.RerankCandidates
+	}
+	return defaultRerankCandidates
+}
+
+// rerankTimeout returns the budget of the reranking.
+func (o Options) rerankTimeout() time.Duration {
+	if o.RerankTimeout > 0 {
+		return o.RerankTimeout
+	}
+	return defaultRerankTimeout
+}
+
+// rerank reorders the first candidates by decreasing relevance scored by the
+// reranker, leaving the others after them in vector order. Reranking the
+// same window whatever the requested page keeps the pagination consistent.
+// The candidates are left untouched when the reranker is not admitted, fails
+// or misses its budget, and false is returned.
+func (s *Server) rerank(ctx context.Context, logger *slog.Logger, query string, candidates []store.SearchHit) ([]store.SearchHit, []float64, bool) {
+	window := min(len(candidates), s.rerankCandidates())
+	if window == 0 {
+		return candidates, nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.opts.rerankTimeout())
+	defer cancel()
+
+	documents := make([]string, window)
+	for i, hit := range candidates[:window] {
+		documents[i] = hit.Text
+		if documents[i] == "" {
+			documents[i] = hit.Title
+		}
+	}
+	startedAt := time.Now()
+	// The reranker is served by the vectorizers, and its calls are admitted
+	// along with theirs.
+	release, err := s.admission.admit(ctx)
+	if err != nil {
+		logger.Warn("Reranking not admitted, falling back to vector order", "error", err, "elapsed", time.Since(startedAt))
+		return candidates, nil, false
+	}
+	scores, err := s.opts.Reranker.Rerank(ctx, query, documents)
+	release()
+	if err == nil && len(scores) != window {
+		err = fmt.Errorf("expected %d scores, got %d", window, len(scores))
+	}
+	if err != nil {
+		logger.Warn("Reranking failed, falling back to vector order", "error", err, "elapsed", time.Since(startedAt))
+		return candidates, nil, false
+	}
+
+	order := make([]int, window)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	reranked := make([]store.SearchHit, 0, len(candidates))
+	rerankScores := make([]float64, window)
+	for i, candidate := range order {
+		reranked = append(reranked, candidates[candidate])
+		rerankScores[i] = scores[candidate]
+	}
+	reranked = append(reranked, candidates[window:]...)
+	logger.Debug("Results reranked", "candidates", window, "elapsed", time.Since(startedAt))
+	return reranked, rerankScores, true
+}
@@ -0,0 +1,148 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// mockReranker implements the Reranker interface for testing.
+type mockReranker struct {
+	scores        map[string]float64
+	err           error
+	delay         time.Duration
+	lastDocuments []string
+}
+
+func (m *mockReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	m.lastDocuments = documents
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if m.err != nil {
+		return nil, m.err
+	}
+	scores := make([]float64, len(documents))
+	for i, document := range documents {
+		scores[i] = m.scores[document]
+	}
+	return scores, nil
+}
+
+func TestSearchRerank(t *testing.T) {
+	hits := []store.SearchHit{
+		{ID: "a", Title: "A", Text: "A. text"},
+		{ID: "b", Title: "B"},
+		{ID: "c", Title: "C", Text: "C. text"},
+		{ID: "d", Title: "D", Text: "D. text"},
+	}
+	testCases := []struct {
+		name             string
+		request          SearchRequest
+		reranker         *mockReranker
+		candidates       int
+		expectedIDs      []string
+		expectedReranked bool
+		expectedScores   []float64
+	}{
+		{
+			name:             "Reordered",
+			request:          SearchRequest{Query: "query", Limit: 4},
+			reranker:         &mockReranker{scores: map[string]float64{"A. text": 0.1, "B": 0.9, "C. text": 0.5, "D. text": 0.3}},
+			candidates:       4,
+			expectedIDs:      []string{"b", "c", "d", "a"},
+			expectedReranked: true,
+			expectedScores:   []float64{0.9, 0.5, 0.3, 0.1},
+		},
+		{
+			name:             "PageOfReorderedWindow",
+			request:          SearchRequest{Query: "query", Limit: 2, Offset: 1},
+			reranker:         &mockReranker{scores: map[string]float64{"A. text": 0.1, "B": 0.9, "C. text": 0.5, "D. text": 0.3}},
+			candidates:       4,
+			expectedIDs:      []string{"c", "d"},
+			expectedReranked: true,
+			expectedScores:   []float64{0.5, 0.3},
+		},
+		{
+			name:             "RemainderInVectorOrder",
+			request:          SearchRequest{Query: "query", Limit: 4},
+			reranker:         &mockReranker{scores: map[string]float64{"A. text": 0.1, "B": 0.9}},
+			candidates:       2,
+			expectedIDs:      []string{"b", "a", "c", "d"},
+			expectedReranked: true,
+			expectedScores:   []float64{0.9, 0.1},
+		},
+		{
+			name:        "RerankerError",
+			request:     SearchRequest{Query: "query", Limit: 4},
+			reranker:    &mockReranker{err: errors.New("connection refused")},
+			candidates:  4,
+			expectedIDs: []string{"a", "b", "c", "d"},
+		},
+		{
+			name:        "BudgetExceeded",
+			request:     SearchRequest{Query: "query", Limit: 4},
+			reranker:    &mockReranker{delay: time.Second},
+			candidates:  4,
+			expectedIDs: []string{"a", "b", "c", "d"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStore := &mockStore{searchResults: hits}
+			server := &Server{
+				store:            mockStore,
+				vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+				opts: Options{
+					Reranker:         tc.reranker,
+					RerankCandidates: tc.candidates,
+					RerankTimeout:    50 * time.Millisecond,
+				},
+			}
+
+			response, err := server.Search(context.Background(), tc.request)
+			require.NoError(t, err)
+
+			// The whole window is fetched from the first neighbour.
+			assert.Equal(t, max(tc.candidates, tc.request.Offset+tc.request.Limit), mockStore.lastK)
+			assert.Zero(t, mockStore.lastOpts.Offset)
+			assert.Equal(t, tc.expectedReranked, response.Reranked)
+
+			var ids []string
+			var scores []float64
+			for _, result := range response.Results {
+				ids = append(ids, result.ID)
+				if result.RerankScore != nil {
+					scores = append(scores, *result.RerankScore)
+				}
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expectedScores, scores)
+		})
+	}
+}
+
+func TestRerankDocuments(t *testing.T) {
+	reranker := &mockReranker{}
+	server := &Server{
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		opts:   Options{Reranker: reranker},
+	}
+
+	// The title is reranked for the articles stored without text.
+	server.rerank(context.Background(), server.logger, "query", []store.SearchHit{{Title: "A", Text: "A. text"}, {Title: "B"}})
+	assert.Equal(t, []string{"A. text", "B"}, reranker.lastDocuments)
+}
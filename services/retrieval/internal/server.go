@@ -2,8 +2,11 @@ package retrieval
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/segmentio/encoding/json"
@@ -13,14 +16,81 @@ import (
 // Vectorizer is an interface for generating embeddings from text.
 type Vectorizer interface {
 	Vectorize(text string) ([]byte, error)
+	VectorizeBatch(texts []string) ([][]byte, error)
 }
 
 // Store is an interface for performing vector search operations.
 type Store interface {
-	VectorSearch(ctx context.Context, queryEmbedding []byte, k int) ([]store.SearchHit, error)
+	VectorSearch(ctx context.Context, queryEmbedding []byte, k int, opts store.SearchOptions) ([]store.SearchHit, error)
+	VectorSearchBatch(ctx context.Context, queries []store.VectorQuery) []store.VectorSearchResult
+	TextSearch(ctx context.Context, query string, k int, opts store.SearchOptions) ([]store.SearchHit, error)
+	SimilarArticles(ctx context.Context, id string, k int, opts store.SearchOptions) ([]store.SearchHit, error)
+	Suggest(ctx context.Context, prefix string, max int) ([]store.Suggestion, error)
+	RecordSuggestionHit(ctx context.Context, title string) error
+	StoreArticles(ctx context.Context, articles []store.Article) error
+	GetArticle(ctx context.Context, id string) (*store.Article, error)
+	DeleteArticle(ctx context.Context, id string) error
+	DeleteSiteArticles(ctx context.Context, site string) (int, error)
 	Close() error
 }
 
+// Options holds the optional settings of the retrieval server.
+type Options struct {
+	// HTTP holds the settings of the HTTP server.
+	HTTP HTTPConfig
+	// AdminToken is the bearer token granting access to the admin API.
+	// The admin API is disabled when empty.
+	AdminToken string
+	// Variants are searched by a share of the queries, instead of the
+	// vectorizer and store of the server.
+	Variants []Variant
+	// Collections are the stores of the named collections, searchable besides
+	// the default collection of the server store.
+	Collections map[string]Store
+	// IndexVersions resolves the live index version of the collection of each
+	// search, along with the vectorizer of its model, so that a swap of the
+	// alias switches the model too. The stores and the vectorizer of the
+	// server are used when nil.
+	IndexVersions IndexVersions
+	// APIKeys maps the API keys to the named collections they grant access to.
+	APIKeys map[string][]string
+	// RequireAPIKey rejects the API requests without a valid API key, except
+	// for the admins.
+	RequireAPIKey bool
+	// RateLimiter limits the rate of the API requests when set, per API key
+	// with KeyRateLimit, and per IP address with IPRateLimit.
+	RateLimiter  RateLimiter
+	KeyRateLimit RateLimit
+	IPRateLimit  RateLimit
+	// ClientIPHeader is the header holding the IP address of the clients, set
+	// by a trusted reverse proxy. Its rightmost address is used, such as the
+	// one appended to X-Forwarded-For by the proxy. The address of the peer is
+	// used when empty.
+	ClientIPHeader string
+	// Admission bounds the vectorizer calls in flight, shedding the searches
+	// beyond its queue.
+	Admission Admission
+	// CircuitBreaker stops calling the vectorizers after consecutive
+	// failures, the searches falling back to a text search of the titles.
+	CircuitBreaker CircuitBreaker
+	// Events logs the searches and the feedback on their results. Nothing is
+	// logged when nil.
+	Events EventLog
+	// Reranker reorders the nearest neighbours of the queries when set.
+	Reranker Reranker
+	// RerankCandidates is the number of nearest neighbours reranked.
+	RerankCandidates int
+	// RerankTimeout is the budget of the reranking, after which the results
+	// are returned in vector order.
+	RerankTimeout time.Duration
+	// RecencyWeight is the default share of the recency of the articles in
+	// the score of the results, from 0 (disabled) to 1.
+	RecencyWeight float64
+	// RecencyHalfLife is the default age at which the recency of an article
+	// is halved.
+	RecencyHalfLife time.Duration
+}
+
 // Server represents the retrieval service server.
 type Server struct {
 	serverPort       string
@@ -28,36 +98,95 @@ type Server struct {
 	store            Store
 	vectorizerClient Vectorizer
 	logger           *slog.Logger
+	opts             Options
+	admission        *admissionController
+	certificates     *certificateLoader
+	vectorizers      versionVectorizers
 }
 
 // New creates a new retrieval server instance.
-func New(serverPort string, store Store, vectorizerClient Vectorizer, logger *slog.Logger) (*Server, error) {
+func New(serverPort string, store Store, vectorizerClient Vectorizer, logger *slog.Logger, opts Options) (*Server, error) {
+	if err := opts.HTTP.validate(); err != nil {
+		return nil, err
+	}
+	var certificates *certificateLoader
+	if opts.HTTP.tls() {
+		var err error
+		if certificates, err = newCertificateLoader(opts.HTTP.TLSCertFile, opts.HTTP.TLSKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateVariants(opts.Variants); err != nil {
+		return nil, err
+	}
+	if err := validateCollections(opts.Collections, opts.APIKeys); err != nil {
+		return nil, err
+	}
+	for _, limit := range []RateLimit{opts.KeyRateLimit, opts.IPRateLimit} {
+		if limit.PerSecond < 0 || (limit.enabled() && limit.Burst <= 0) {
+			return nil, fmt.Errorf("invalid rate limit of %v requests per second with a burst of %d", limit.PerSecond, limit.Burst)
+		}
+	}
+	if opts.RecencyWeight < 0 || opts.RecencyWeight > 1 || opts.RecencyHalfLife < 0 {
+		return nil, fmt.Errorf("invalid recency weight %v or half-life %v", opts.RecencyWeight, opts.RecencyHalfLife)
+	}
+	if a := opts.Admission; a.MaxConcurrent < 0 || a.MaxQueue < 0 || a.MaxQueueWait < 0 {
+		return nil, fmt.Errorf("invalid admission of %d calls in flight, %d queued for %v", a.MaxConcurrent, a.MaxQueue, a.MaxQueueWait)
+	}
+	if c := opts.CircuitBreaker; c.FailureThreshold < 0 || (c.enabled() && c.OpenTimeout <= 0) {
+		return nil, fmt.Errorf("invalid circuit breaker of %d failures open for %v", c.FailureThreshold, c.OpenTimeout)
+	}
+	// Each vectorizer has its own circuit.
+	vectorizerClient = withCircuitBreaker(vectorizerClient, opts.CircuitBreaker, logger.With("variant", controlVariant))
+	opts.Variants = slices.Clone(opts.Variants)
+	for i, variant := range opts.Variants {
+		opts.Variants[i].Vectorizer = withCircuitBreaker(variant.Vectorizer, opts.CircuitBreaker, logger.With("variant", variant.Name))
+	}
 	return &Server{
 		serverPort:       serverPort,
 		store:            store,
 		vectorizerClient: vectorizerClient,
 		logger:           logger,
+		opts:             opts,
+		admission:        newAdmissionController(opts.Admission),
+		certificates:     certificates,
+		vectorizers:      versionVectorizers{vectorizers: make(map[string]Vectorizer)},
 	}, nil
 }
 
 // Start starts the HTTP server for the retrieval service. The call is blocking.
 func (s *Server) Start() error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/search", s.handleSearch)
-	mux.HandleFunc("/health", s.handleHealth)
+	s.httpServer = s.newHTTPServer(s.routes())
 
-	s.httpServer = &http.Server{
-		Addr:         ":" + s.serverPort,
-		Handler:      mux,
-		ReadTimeout:  1 * time.Second,
-		WriteTimeout: 1 * time.Second,
+	s.logger.Info("Retrieval service starting", "addr", s.httpServer.Addr, "tls", s.certificates != nil, "h2c", s.opts.HTTP.H2C)
+	if s.certificates != nil {
+		// The certificate is provided by the TLS config.
+		return s.httpServer.ListenAndServeTLS("", "")
 	}
-
-	s.logger.Info("Retrieval service starting", "port", s.serverPort)
 	return s.httpServer.ListenAndServe()
 }
 
+// routes returns the handler of the service endpoints.
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/search", s.requireAPIAccess(s.handleSearch))
+	mux.Handle("/search/batch", s.requireAPIAccess(s.handleSearchBatch))
+	mux.Handle("/suggest", s.requireAPIAccess(s.handleSuggest))
+	mux.Handle("/suggest/hit", s.requireAPIAccess(s.handleSuggestHit))
+	mux.Handle("/feedback", s.requireAPIAccess(s.handleFeedback))
+	mux.Handle("GET /articles/{id}/similar", s.requireAPIAccess(s.handleSimilar))
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.Handle("GET /admin/articles/{id}", s.requireAdmin(s.handleGetArticle))
+	mux.Handle("DELETE /admin/articles/{id}", s.requireAdmin(s.handleDeleteArticle))
+	mux.Handle("DELETE /admin/articles", s.requireAdmin(s.handleDeleteSiteArticles))
+	mux.Handle("POST /admin/articles", s.requireAdmin(s.handleUpsertArticle))
+	mux.Handle("/", s.withSessionCookie(uiHandler()))
+	return withRequestID(mux)
+}
+
 // Shutdown gracefully shuts down the server.
+// The variants and collections stores are expected to share the connection of the server store,
+// and are not closed.
 func (s *Server) Shutdown() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -67,80 +196,509 @@ func (s *Server) Shutdown() {
 	s.store.Close()
 }
 
-// SearchRequest represents a search request payload.
+const (
+	// defaultLimit is the number of results returned when no limit is requested.
+	defaultLimit = 10
+	// maxLimit is the maximum number of results that can be requested, and
+	// the maximum rank of the results that can be paginated to.
+	maxLimit = 100
+	// overfetchFactor is the factor of the number of neighbours fetched when
+	// the candidates are rescored or filtered, to fill the requested page.
+	overfetchFactor = 3
+	// maxEFRuntime caps the HNSW EF_RUNTIME override of a query, which
+	// trades latency for recall.
+	maxEFRuntime = 1000
+)
+
+// SearchRequest represents a search request payload. The search is run with
+// exactly one of the query, vector and document.
 type SearchRequest struct {
 	Query string `json:"query"`
+	// Collection is the named collection to search, rather than the default
+	// one. It requires an API key granting access to it.
+	Collection string `json:"collection,omitempty"`
+	// Vector is a query embedding computed by the caller, as base64 FLOAT32
+	// little-endian values of the dimension of the index.
+	Vector string `json:"vector,omitempty"`
+	// Document is a text longer than a query, such as a paragraph, embedded
+	// as the mean of the embeddings of its chunks.
+	Document string `json:"document,omitempty"`
+	Limit    int    `json:"limit,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	Site     string `json:"site,omitempty"`
+	// EFRuntime overrides the HNSW EF_RUNTIME of the index for the query.
+	EFRuntime int `json:"ef_runtime,omitempty"`
+	// Variant requests the variant to search with, rather than drawing it.
+	Variant string `json:"variant,omitempty"`
+	// MinScore drops the results with a lower score, from 0 to 1.
+	MinScore float64 `json:"min_score,omitempty"`
+	// WithDistance adds the raw distance of the index metric to the results.
+	WithDistance bool `json:"with_distance,omitempty"`
+	// Diversity trades the relevance of the results for their novelty, from
+	// 0 (relevance only) to 1, with Maximal Marginal Relevance.
+	Diversity float64 `json:"diversity,omitempty"`
+	// DedupThreshold drops the results at least as similar to a more
+	// relevant one, from 0 (disabled) to 1, by the cosine similarity of their
+	// embeddings whatever the index metric.
+	DedupThreshold float64 `json:"dedup_threshold,omitempty"`
+	// MaxPerSite caps the number of results of each site when positive.
+	MaxPerSite int `json:"max_per_site,omitempty"`
+	// RecencyWeight overrides the configured share of the recency of the
+	// articles in the score, from 0 (disabled) to 1.
+	RecencyWeight *float64 `json:"recency_weight,omitempty"`
+	// RecencyHalfLife overrides the configured age at which the recency of an
+	// article is halved, as a duration such as "168h".
+	RecencyHalfLife string `json:"recency_half_life,omitempty"`
+	// Explain details how the results were scored and ranked. It is
+	// restricted to the admin callers.
+	Explain bool `json:"explain,omitempty"`
+	// session identifies the client the variant is drawn for, see
+	// variantSession.
+	session string
 }
 
 // SearchResult represents a single search result.
 type SearchResult struct {
-	Title string  `json:"title"`
-	URL   string  `json:"url"`
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Site        string     `json:"site"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// Score is the similarity of the result to the query, from 0 to 1,
+	// higher meaning more similar.
 	Score float64 `json:"score"`
+	// Distance is the raw distance of the index metric, lower meaning more
+	// similar, when requested.
+	Distance *float64 `json:"distance,omitempty"`
+	// Similarity and Recency are the components of the score, from 0 to 1,
+	// when the results are ranked by recency.
+	Similarity *float64 `json:"similarity,omitempty"`
+	Recency    *float64 `json:"recency,omitempty"`
+	// Explain details how the result was scored and ranked, when requested.
+	Explain *ResultExplanation `json:"explain,omitempty"`
+	// RerankScore is the relevance scored by the reranker, higher meaning
+	// more relevant, for the reranked results.
+	RerankScore *float64 `json:"rerank_score,omitempty"`
 }
 
 // SearchResponse represents the search response payload.
 type SearchResponse struct {
-	Results []SearchResult `json:"results"`
-	Count   int            `json:"count"`
+	// SearchID identifies the search for the feedback on its results.
+	SearchID string         `json:"search_id"`
+	Results  []SearchResult `json:"results"`
+	Count    int            `json:"count"`
+	// Variant is the name of the variant the search was performed with.
+	Variant string `json:"variant"`
+	// Reranked reports whether the results were reordered by the reranker.
+	Reranked bool `json:"reranked"`
+	// Degraded reports that the vectorizer was unavailable, and the results
+	// are those of a text search of the titles.
+	Degraded bool `json:"degraded"`
+	// Explain details how the search was performed, when requested.
+	Explain *SearchExplanation `json:"explain,omitempty"`
 }
 
 // handleSearch handles the /search endpoint.
+// The search parameters are read from the query string for GET requests, and
+// from the JSON body for POST requests.
 func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	var req SearchRequest
+	switch r.Method {
+	case http.MethodGet:
+		if apiErr := parseSearchParams(r.URL.Query(), &req); apiErr != nil {
+			s.writeError(w, r, apiErr)
+			return
+		}
+	case http.MethodPost:
+		if apiErr := decodeRequest(w, r, &req); apiErr != nil {
+			s.writeError(w, r, apiErr)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		s.writeError(w, r, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
-	var req SearchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	format := negotiateFormat(r.Header.Get("Accept"))
+	req.session = s.variantSession(w, r, format == formatHTML)
+	if format == formatHTML && r.Method == http.MethodGet && normalizeQuery(req.Query) == "" && req.Vector == "" && req.Document == "" {
+		// Browsers landing on the page without a query get the empty search form.
+		s.writeSearchResponse(w, r, format, req, nil)
 		return
 	}
-	s.logger.Debug("Search query received", "query", req.Query)
 
-	embeddingBytes, err := s.vectorizerClient.Vectorize(req.Query)
-	if err != nil {
-		s.logger.Error("Failed to generate query embedding", "error", err, "query", req.Query)
-		http.Error(w, "Failed to generate query embedding", http.StatusInternalServerError)
+	if req.Explain && !s.isAdmin(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		s.writeError(w, r, newAPIError(CodeUnauthorized, "Explain requires the admin token"))
+		return
+	}
+	if apiErr := s.authorizeCollection(r, req.Collection); apiErr != nil {
+		s.writeError(w, r, apiErr)
 		return
 	}
 
-	// TODO: Make 'k' configurable via request parameters.
-	searchResults, err := s.store.VectorSearch(context.Background(), embeddingBytes, 10)
-	if err != nil {
-		s.logger.Error("Vector search failed", "error", err, "query", req.Query)
-		http.Error(w, "Vector search failed", http.StatusInternalServerError)
+	response, apiErr := s.search(r.Context(), &req)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
 		return
 	}
+	w.Header().Set("X-Search-Variant", response.Variant)
+	s.writeSearchResponse(w, r, format, req, response)
+}
+
+// Search runs a search request as the /search endpoint does. The returned
+// error is an *APIError.
+func (s *Server) Search(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
+	response, apiErr := s.search(ctx, &req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	return response, nil
+}
+
+// search runs the search request. The request query is normalized in place.
+func (s *Server) search(ctx context.Context, req *SearchRequest) (*SearchResponse, *APIError) {
+	plan, apiErr := s.planSearch(ctx, req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	embeddingBytes, apiErr := s.embedQuery(ctx, plan)
+	if apiErr != nil {
+		return nil, s.failSearch(ctx, plan, apiErr)
+	}
+	plan.timer.lap("embedding")
 
-	results := make([]SearchResult, 0, len(searchResults))
-	for _, sr := range searchResults {
-		results = append(results, SearchResult{
-			Title: sr.Title,
-			URL:   sr.Link,
-			Score: sr.Score,
-		})
+	if plan.degraded {
+		searchResults, err := plan.variant.Store.TextSearch(ctx, plan.text, plan.k, plan.searchOpts)
+		if err != nil {
+			plan.logger.Error("Text search failed", "error", err)
+			return nil, s.failSearch(ctx, plan, upstreamError(err, CodeStoreUnavailable, "Text search failed"))
+		}
+		plan.timer.lap("text_search")
+		return s.completeSearch(ctx, plan, searchResults), nil
 	}
+	searchResults, err := plan.variant.Store.VectorSearch(ctx, embeddingBytes, plan.k, plan.searchOpts)
+	if err != nil {
+		return nil, s.failSearch(ctx, plan, vectorSearchError(plan, err))
+	}
+	plan.timer.lap("vector_search")
+
+	return s.completeSearch(ctx, plan, searchResults), nil
+}
 
-	response := SearchResponse{
+// vectorSearchError returns the error of a failed vector search. Requested
+// vectors without the dimension of the index are invalid requests.
+func vectorSearchError(plan *searchPlan, err error) *APIError {
+	if errors.Is(err, store.ErrDimensionMismatch) {
+		return newAPIError(CodeInvalidRequest, "Vector dimension does not match the index")
+	}
+	plan.logger.Error("Vector search failed", "error", err)
+	return upstreamError(err, CodeStoreUnavailable, "Vector search failed")
+}
+
+// searchPlan is a validated search request, with the settings of its stages.
+type searchPlan struct {
+	req *SearchRequest
+	// text is the normalized query or document, empty for vector searches.
+	text string
+	// chunks are the texts embedded for the search, and embedding the
+	// requested vector for vector searches.
+	chunks     []string
+	embedding  []byte
+	variant    Variant
+	logger     *slog.Logger
+	k          int
+	searchOpts store.SearchOptions
+	diversify  diversifyOptions
+	recency    recencyOptions
+	// rerank is set when the candidates are reranked, which requires a text.
+	rerank bool
+	// degraded is set when the vectorizer is unavailable, and the text is
+	// searched in the titles instead.
+	degraded bool
+	// windowed is set when the candidates are reordered, and fetched from the
+	// first neighbour whatever the requested page.
+	windowed bool
+	timer    *stageTimer
+	event    store.SearchEvent
+}
+
+// planSearch validates the search request and plans its stages. The request
+// query and document are normalized in place.
+func (s *Server) planSearch(ctx context.Context, req *SearchRequest) (*searchPlan, *APIError) {
+	req.Query = normalizeQuery(req.Query)
+	if (req.Query != "" && (req.Vector != "" || req.Document != "")) || (req.Vector != "" && req.Document != "") {
+		return nil, newAPIError(CodeInvalidRequest, "Only one of query, vector and document can be searched")
+	}
+	var text string
+	var chunks []string
+	var embedding []byte
+	var apiErr *APIError
+	switch {
+	case req.Vector != "":
+		embedding, apiErr = decodeQueryVector(req.Vector)
+	case req.Document != "":
+		req.Document = normalizeQuery(req.Document)
+		text = req.Document
+		chunks, apiErr = chunkDocument(req.Document)
+	default:
+		text = req.Query
+		chunks = []string{req.Query}
+		apiErr = validateQuery(req.Query)
+	}
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultLimit
+	}
+	if req.Limit < 0 || req.Limit > maxLimit {
+		return nil, newAPIError(CodeInvalidRequest, fmt.Sprintf("Limit must be between 1 and %d", maxLimit))
+	}
+	if req.Offset < 0 || req.Offset+req.Limit > maxLimit {
+		return nil, newAPIError(CodeInvalidRequest, fmt.Sprintf("Offset must be positive, and offset + limit must not exceed %d", maxLimit))
+	}
+	if req.EFRuntime < 0 || req.EFRuntime > maxEFRuntime {
+		return nil, newAPIError(CodeInvalidRequest, fmt.Sprintf("EF runtime must be between 1 and %d", maxEFRuntime))
+	}
+	if !(req.MinScore >= 0 && req.MinScore <= 1) {
+		return nil, newAPIError(CodeInvalidRequest, "Min score must be between 0 and 1")
+	}
+	if !(req.Diversity >= 0 && req.Diversity <= 1) {
+		return nil, newAPIError(CodeInvalidRequest, "Diversity must be between 0 and 1")
+	}
+	if !(req.DedupThreshold >= 0 && req.DedupThreshold <= 1) {
+		return nil, newAPIError(CodeInvalidRequest, "Dedup threshold must be between 0 and 1")
+	}
+	if req.MaxPerSite < 0 || req.MaxPerSite > maxLimit {
+		return nil, newAPIError(CodeInvalidRequest, fmt.Sprintf("Max per site must be between 1 and %d", maxLimit))
+	}
+	recencyOpts, apiErr := s.recencyOptions(req)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	variant, apiErr := s.searchVariant(ctx, req, embedding != nil)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	searchID := newRequestID()
+	logger := s.logger.With("query", text, "collection", req.Collection, "request_id", requestIDFromContext(ctx), "search_id", searchID, "variant", variant.Name)
+	logger.Debug("Search query received", "chunks", len(chunks), "vector", embedding != nil, "limit", req.Limit, "offset", req.Offset, "site", req.Site, "ef_runtime", req.EFRuntime, "min_score", req.MinScore)
+
+	plan := &searchPlan{
+		req:       req,
+		text:      text,
+		chunks:    chunks,
+		embedding: embedding,
+		variant:   variant,
+		logger:    logger,
+		k:         req.Offset + req.Limit,
+		searchOpts: store.SearchOptions{
+			Site:      req.Site,
+			Offset:    req.Offset,
+			EFRuntime: req.EFRuntime,
+			MinScore:  req.MinScore,
+		},
+		diversify: diversifyOptions{
+			diversity:      req.Diversity,
+			dedupThreshold: req.DedupThreshold,
+			maxPerSite:     req.MaxPerSite,
+		},
+		recency: recencyOpts,
+		timer:   newStageTimer(),
+		event: store.SearchEvent{
+			SearchID:   searchID,
+			Collection: req.Collection,
+			Query:      text,
+			Site:       req.Site,
+			Limit:      req.Limit,
+			Offset:     req.Offset,
+			Variant:    variant.Name,
+		},
+	}
+	plan.rerank = s.opts.Reranker != nil && len(chunks) > 0
+	plan.windowed = plan.rerank || plan.diversify.enabled() || plan.recency.enabled()
+	if plan.windowed {
+		plan.searchOpts.Offset = 0
+	}
+	if plan.rerank {
+		plan.k = max(plan.k, s.rerankCandidates())
+	}
+	if plan.diversify.enabled() || plan.recency.enabled() {
+		plan.k = max(plan.k, overfetchFactor*(req.Offset+req.Limit))
+		plan.searchOpts.WithEmbeddings = plan.diversify.needsEmbeddings()
+	}
+	return plan, nil
+}
+
+// searchVariant returns the variant to run the search request with. The
+// variants only have an index of the default collection, and the vectors are
+// computed with the model of the control variant unless a variant is
+// requested.
+func (s *Server) searchVariant(ctx context.Context, req *SearchRequest, vector bool) (Variant, *APIError) {
+	if req.Collection == "" {
+		if vector && req.Variant == "" {
+			return s.pickVariant(ctx, controlVariant, "")
+		}
+		// The variant is drawn from the client, or from the text for the
+		// unidentified clients, so that their pages and repeated searches
+		// are routed to the same variant.
+		routingKey := req.session
+		if routingKey == "" {
+			routingKey = "text:" + req.Query + req.Document
+		}
+		return s.pickVariant(ctx, req.Variant, routingKey)
+	}
+	if req.Variant != "" && req.Variant != controlVariant {
+		return Variant{}, newAPIError(CodeInvalidRequest, "Variants cannot be searched in a named collection")
+	}
+	collectionStore, apiErr := s.collectionStore(req.Collection)
+	if apiErr != nil {
+		return Variant{}, apiErr
+	}
+	return s.liveVariant(ctx, req.Collection, collectionStore), nil
+}
+
+// failSearch records the failure of a planned search, and returns its error.
+func (s *Server) failSearch(ctx context.Context, plan *searchPlan, apiErr *APIError) *APIError {
+	plan.event.Latency = time.Since(plan.timer.started)
+	plan.event.Error = string(apiErr.Code)
+	s.recordSearch(ctx, plan.event)
+	return apiErr
+}
+
+// completeSearch reorders the candidates of a planned search, and returns the
+// requested page of results.
+func (s *Server) completeSearch(ctx context.Context, plan *searchPlan, searchResults []store.SearchHit) *SearchResponse {
+	req := plan.req
+	candidates := len(searchResults)
+	var vectorOrder map[string]vectorHit
+	if req.Explain {
+		vectorOrder = vectorHits(searchResults, plan.searchOpts.Offset+1)
+	}
+
+	// The candidates ranked by recency are diversified with their combined
+	// score, then reranked, rather than the other way around, as the reranker
+	// scores are not comparable to the similarities.
+	var components map[string]scoreComponents
+	if plan.recency.enabled() {
+		components = rankByRecency(searchResults, plan.recency, time.Now())
+		plan.timer.lap("recency")
+	}
+	if plan.diversify.enabled() {
+		searchResults = diversify(searchResults, plan.diversify)
+		plan.timer.lap("diversify")
+	}
+	var rerankScores []float64
+	reranked := false
+	if plan.rerank {
+		// Documents are reranked with their first chunk, as the reranker
+		// truncates the query and document pairs.
+		searchResults, rerankScores, reranked = s.rerank(ctx, plan.logger, plan.chunks[0], searchResults)
+		plan.timer.lap("rerank")
+	}
+	if plan.windowed {
+		searchResults = searchResults[min(req.Offset, len(searchResults)):min(req.Offset+req.Limit, len(searchResults))]
+	}
+
+	response := newSearchResponse(searchResults)
+	response.SearchID = plan.event.SearchID
+	response.Variant = plan.variant.Name
+	response.Reranked = reranked
+	response.Degraded = plan.degraded
+	for i := range response.Results {
+		if rank := req.Offset + i; rank < len(rerankScores) {
+			response.Results[i].RerankScore = &rerankScores[rank]
+		}
+		if req.WithDistance {
+			response.Results[i].Distance = &searchResults[i].Distance
+		}
+		if c, ok := components[response.Results[i].ID]; ok {
+			response.Results[i].Similarity = &c.similarity
+			response.Results[i].Recency = &c.recency
+		}
+		if req.Explain {
+			vector := vectorOrder[response.Results[i].ID]
+			response.Results[i].Explain = &ResultExplanation{
+				VectorRank:  vector.rank,
+				Distance:    searchResults[i].Distance,
+				Similarity:  vector.similarity,
+				Recency:     response.Results[i].Recency,
+				RerankScore: response.Results[i].RerankScore,
+				Text:        searchResults[i].Text,
+			}
+		}
+	}
+	if req.Explain {
+		response.Explain = &SearchExplanation{
+			Query:      plan.text,
+			Candidates: candidates,
+			Timings:    plan.timer.total(),
+		}
+	}
+
+	plan.event.Latency = time.Since(plan.timer.started)
+	plan.event.Degraded = plan.degraded
+	plan.event.ResultIDs = make([]string, 0, len(response.Results))
+	for _, result := range response.Results {
+		plan.event.ResultIDs = append(plan.event.ResultIDs, result.ID)
+	}
+	s.recordSearch(ctx, plan.event)
+	s.recordSearchedTitle(ctx, plan, response.Results)
+	plan.logger.Debug("Search completed", "count", response.Count)
+	return response
+}
+
+// newSearchResponse builds the response payload from the store search hits.
+func newSearchResponse(hits []store.SearchHit) *SearchResponse {
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		result := SearchResult{
+			ID:    hit.ID,
+			Title: hit.Title,
+			URL:   hit.Link,
+			Site:  hit.Site,
+			Score: hit.Score,
+		}
+		if !hit.PublishedAt.IsZero() {
+			result.PublishedAt = &hit.PublishedAt
+		}
+		results = append(results, result)
+	}
+
+	return &SearchResponse{
 		Results: results,
 		Count:   len(results),
 	}
+}
 
+// writeJSON writes the payload as a JSON response with the given status.
+func (s *Server) writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		s.logger.Error("Failed to encode search response", "error", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		s.logger.Error("Failed to encode response", "error", err)
 	}
 }
 
+// HealthResponse represents the health check payload.
+type HealthResponse struct {
+	Status string `json:"status"`
+	// Admission reports the vectorizer calls in flight and queued, when
+	// admission control is enabled.
+	Admission *AdmissionStats `json:"admission,omitempty"`
+	// Circuit is the state of the circuit of the vectorizer of the live index
+	// version, closed, open or half_open, when the circuit breaker is enabled.
+	Circuit string `json:"circuit,omitempty"`
+}
+
 // handleHealth handles the /health endpoint.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	s.logger.Debug("Received health check request")
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]string{"status": "ok"}); err != nil {
+	if err := json.NewEncoder(w).Encode(HealthResponse{Status: "ok", Admission: s.admission.stats(), Circuit: vectorizerCircuit(s.liveVariant(r.Context(), "", s.store).Vectorizer)}); err != nil {
 		s.logger.Error("Failed to encode health response", "error", err)
 	}
 }
@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,34 +31,144 @@ func (m *mockVectorizer) Vectorize(text string) ([]byte, error) {
 	return m.embedding, nil
 }
 
+func (m *mockVectorizer) VectorizeBatch(texts []string) ([][]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	embeddings := make([][]byte, len(texts))
+	for i := range texts {
+		embeddings[i] = m.embedding
+	}
+	return embeddings, nil
+}
+
 // mockStore implements the Store interface for testing.
 type mockStore struct {
-	searchResults []store.SearchHit
-	searchErr     error
+	searchResults  []store.SearchHit
+	searchErr      error
+	lastK          int
+	lastOpts       store.SearchOptions
+	lastEmbedding  []byte
+	textResults    []store.SearchHit
+	lastTextQuery  string
+	lastID         string
+	storeErr       error
+	storedArticles []store.Article
+	suggestions    []store.Suggestion
+	suggestErr     error
+	lastPrefix     string
+	hits           []string
+}
+
+func (m *mockStore) VectorSearch(ctx context.Context, queryEmbedding []byte, k int, opts store.SearchOptions) ([]store.SearchHit, error) {
+	m.lastEmbedding = queryEmbedding
+	m.lastK = k
+	m.lastOpts = opts
+	if m.searchErr != nil {
+		return nil, m.searchErr
+	}
+	return m.searchResults, nil
+}
+
+func (m *mockStore) TextSearch(ctx context.Context, query string, k int, opts store.SearchOptions) ([]store.SearchHit, error) {
+	m.lastTextQuery = query
+	m.lastK = k
+	m.lastOpts = opts
+	if m.searchErr != nil {
+		return nil, m.searchErr
+	}
+	return m.textResults, nil
+}
+
+func (m *mockStore) VectorSearchBatch(ctx context.Context, queries []store.VectorQuery) []store.VectorSearchResult {
+	results := make([]store.VectorSearchResult, len(queries))
+	for i, query := range queries {
+		results[i].Hits, results[i].Err = m.VectorSearch(ctx, query.Embedding, query.K, query.Opts)
+	}
+	return results
 }
 
-func (m *mockStore) VectorSearch(ctx context.Context, queryEmbedding []byte, k int) ([]store.SearchHit, error) {
+func (m *mockStore) SimilarArticles(ctx context.Context, id string, k int, opts store.SearchOptions) ([]store.SearchHit, error) {
+	m.lastID = id
+	m.lastK = k
+	m.lastOpts = opts
 	if m.searchErr != nil {
 		return nil, m.searchErr
 	}
 	return m.searchResults, nil
 }
 
+func (m *mockStore) Suggest(ctx context.Context, prefix string, max int) ([]store.Suggestion, error) {
+	m.lastPrefix = prefix
+	m.lastK = max
+	if m.suggestErr != nil {
+		return nil, m.suggestErr
+	}
+	return m.suggestions, nil
+}
+
+func (m *mockStore) RecordSuggestionHit(ctx context.Context, title string) error {
+	if m.suggestErr != nil {
+		return m.suggestErr
+	}
+	m.hits = append(m.hits, title)
+	return nil
+}
+
+func (m *mockStore) StoreArticles(ctx context.Context, articles []store.Article) error {
+	if m.storeErr != nil {
+		return m.storeErr
+	}
+	m.storedArticles = append(m.storedArticles, articles...)
+	return nil
+}
+
+func (m *mockStore) GetArticle(ctx context.Context, id string) (*store.Article, error) {
+	m.lastID = id
+	if m.storeErr != nil {
+		return nil, m.storeErr
+	}
+	for _, article := range m.storedArticles {
+		if article.Title == id {
+			return &article, nil
+		}
+	}
+	return nil, store.ErrArticleNotFound
+}
+
+func (m *mockStore) DeleteArticle(ctx context.Context, id string) error {
+	m.lastID = id
+	return m.storeErr
+}
+
+func (m *mockStore) DeleteSiteArticles(ctx context.Context, site string) (int, error) {
+	m.lastOpts = store.SearchOptions{Site: site}
+	if m.storeErr != nil {
+		return 0, m.storeErr
+	}
+	return len(m.storedArticles), nil
+}
+
 func (m *mockStore) Close() error {
 	return nil
 }
 
 func TestHandleSearch(t *testing.T) {
+	distance := 0.05
 	testCases := []struct {
 		name               string
 		requestBody        interface{}
 		requestMethod      string
+		requestURL         string
 		mockVectorizer     *mockVectorizer
 		mockStore          *mockStore
 		expectedStatus     int
 		expectedCount      int
 		expectedResults    []SearchResult
 		expectErrorMessage string
+		expectedErrorCode  ErrorCode
+		expectedK          int
+		expectedOpts       store.SearchOptions
 	}{
 		{
 			name: "Success",
@@ -79,6 +191,180 @@ func TestHandleSearch(t *testing.T) {
 				{Title: "Result 1", URL: "http://example.com/1", Score: 0.95},
 				{Title: "Result 2", URL: "http://example.com/2", Score: 0.85},
 			},
+			expectedK: defaultLimit,
+		},
+		{
+			name: "SuccessWithLimitAndSite",
+			requestBody: SearchRequest{
+				Query: "test query",
+				Limit: 20,
+				Site:  "vsd.fr",
+			},
+			requestMethod: http.MethodPost,
+			mockVectorizer: &mockVectorizer{
+				embedding: []byte("test-embedding"),
+			},
+			mockStore: &mockStore{
+				searchResults: []store.SearchHit{
+					{Title: "Result 1", Link: "http://vsd.fr/1", Site: "vsd.fr", Score: 0.95},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+			expectedResults: []SearchResult{
+				{Title: "Result 1", URL: "http://vsd.fr/1", Site: "vsd.fr", Score: 0.95},
+			},
+			expectedK:    20,
+			expectedOpts: store.SearchOptions{Site: "vsd.fr"},
+		},
+		{
+			name:          "SuccessGet",
+			requestMethod: http.MethodGet,
+			requestURL:    "/search?q=test+query&limit=5&site=public.fr",
+			mockVectorizer: &mockVectorizer{
+				embedding: []byte("test-embedding"),
+			},
+			mockStore: &mockStore{
+				searchResults: []store.SearchHit{
+					{Title: "Result 1", Link: "http://public.fr/1", Site: "public.fr", Score: 0.95},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+			expectedResults: []SearchResult{
+				{Title: "Result 1", URL: "http://public.fr/1", Site: "public.fr", Score: 0.95},
+			},
+			expectedK:    5,
+			expectedOpts: store.SearchOptions{Site: "public.fr"},
+		},
+		{
+			name: "SuccessWithOffset",
+			requestBody: SearchRequest{
+				Query:  "test query",
+				Limit:  10,
+				Offset: 20,
+			},
+			requestMethod: http.MethodPost,
+			mockVectorizer: &mockVectorizer{
+				embedding: []byte("test-embedding"),
+			},
+			mockStore: &mockStore{
+				searchResults: []store.SearchHit{},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedCount:   0,
+			expectedResults: []SearchResult{},
+			expectedK:       30,
+			expectedOpts:    store.SearchOptions{Offset: 20},
+		},
+		{
+			name: "OffsetTooHigh",
+			requestBody: SearchRequest{
+				Query:  "test query",
+				Limit:  10,
+				Offset: maxLimit,
+			},
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "offset + limit must not exceed",
+			expectedErrorCode:  CodeInvalidRequest,
+		},
+		{
+			name:          "SuccessWithEFRuntime",
+			requestMethod: http.MethodGet,
+			requestURL:    "/search?q=test+query&ef_runtime=200",
+			mockVectorizer: &mockVectorizer{
+				embedding: []byte("test-embedding"),
+			},
+			mockStore: &mockStore{
+				searchResults: []store.SearchHit{},
+			},
+			expectedStatus:  http.StatusOK,
+			expectedCount:   0,
+			expectedResults: []SearchResult{},
+			expectedK:       defaultLimit,
+			expectedOpts:    store.SearchOptions{EFRuntime: 200},
+		},
+		{
+			name: "EFRuntimeTooHigh",
+			requestBody: SearchRequest{
+				Query:     "test query",
+				EFRuntime: maxEFRuntime + 1,
+			},
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "EF runtime must be between",
+			expectedErrorCode:  CodeInvalidRequest,
+		},
+		{
+			name:          "SuccessWithMinScoreAndDistance",
+			requestMethod: http.MethodGet,
+			requestURL:    "/search?q=test+query&min_score=0.5&with_distance=true",
+			mockVectorizer: &mockVectorizer{
+				embedding: []byte("test-embedding"),
+			},
+			mockStore: &mockStore{
+				searchResults: []store.SearchHit{
+					{Title: "Result 1", Link: "http://example.com/1", Score: 0.95, Distance: distance},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  1,
+			expectedResults: []SearchResult{
+				{Title: "Result 1", URL: "http://example.com/1", Score: 0.95, Distance: &distance},
+			},
+			expectedK:    defaultLimit,
+			expectedOpts: store.SearchOptions{MinScore: 0.5},
+		},
+		{
+			name: "MinScoreOutOfRange",
+			requestBody: SearchRequest{
+				Query:    "test query",
+				MinScore: 1.5,
+			},
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "Min score must be between 0 and 1",
+			expectedErrorCode:  CodeInvalidRequest,
+		},
+		{
+			name:               "GetInvalidMinScore",
+			requestMethod:      http.MethodGet,
+			requestURL:         "/search?q=test&min_score=NaN",
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "Min score must be between 0 and 1",
+			expectedErrorCode:  CodeInvalidRequest,
+		},
+		{
+			name:               "GetInvalidLimit",
+			requestMethod:      http.MethodGet,
+			requestURL:         "/search?q=test&limit=ten",
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "Invalid limit",
+			expectedErrorCode:  CodeInvalidRequest,
+		},
+		{
+			name: "LimitTooHigh",
+			requestBody: SearchRequest{
+				Query: "test query",
+				Limit: maxLimit + 1,
+			},
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "Limit must be between",
+			expectedErrorCode:  CodeInvalidRequest,
 		},
 		{
 			name: "SuccessEmptyResults",
@@ -95,15 +381,17 @@ func TestHandleSearch(t *testing.T) {
 			expectedStatus:  http.StatusOK,
 			expectedCount:   0,
 			expectedResults: []SearchResult{},
+			expectedK:       defaultLimit,
 		},
 		{
 			name:               "MethodNotAllowed",
 			requestBody:        SearchRequest{Query: "test"},
-			requestMethod:      http.MethodGet,
+			requestMethod:      http.MethodPut,
 			mockVectorizer:     &mockVectorizer{},
 			mockStore:          &mockStore{},
 			expectedStatus:     http.StatusMethodNotAllowed,
 			expectErrorMessage: "Method not allowed",
+			expectedErrorCode:  CodeMethodNotAllowed,
 		},
 		{
 			name:               "InvalidRequestBody",
@@ -113,6 +401,7 @@ func TestHandleSearch(t *testing.T) {
 			mockStore:          &mockStore{},
 			expectedStatus:     http.StatusBadRequest,
 			expectErrorMessage: "Invalid request body",
+			expectedErrorCode:  CodeInvalidRequest,
 		},
 		{
 			name: "VectorizerError",
@@ -124,8 +413,23 @@ func TestHandleSearch(t *testing.T) {
 				err: errors.New("vectorization failed"),
 			},
 			mockStore:          &mockStore{},
-			expectedStatus:     http.StatusInternalServerError,
+			expectedStatus:     http.StatusBadGateway,
 			expectErrorMessage: "Failed to generate query embedding",
+			expectedErrorCode:  CodeEmbeddingUnavailable,
+		},
+		{
+			name: "VectorizerTimeout",
+			requestBody: SearchRequest{
+				Query: "test query",
+			},
+			requestMethod: http.MethodPost,
+			mockVectorizer: &mockVectorizer{
+				err: fmt.Errorf("failed to send request to vectorizer: %w", context.DeadlineExceeded),
+			},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusGatewayTimeout,
+			expectErrorMessage: "Failed to generate query embedding",
+			expectedErrorCode:  CodeTimeout,
 		},
 		{
 			name: "VectorSearchError",
@@ -139,8 +443,9 @@ func TestHandleSearch(t *testing.T) {
 			mockStore: &mockStore{
 				searchErr: errors.New("search failed"),
 			},
-			expectedStatus:     http.StatusInternalServerError,
+			expectedStatus:     http.StatusServiceUnavailable,
 			expectErrorMessage: "Vector search failed",
+			expectedErrorCode:  CodeStoreUnavailable,
 		},
 		{
 			name: "EmptyQuery",
@@ -151,12 +456,54 @@ func TestHandleSearch(t *testing.T) {
 			mockVectorizer: &mockVectorizer{
 				embedding: []byte("test-embedding"),
 			},
-			mockStore: &mockStore{
-				searchResults: []store.SearchHit{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "Query cannot be empty",
+			expectedErrorCode:  CodeEmptyQuery,
+		},
+		{
+			name: "WhitespaceQuery",
+			requestBody: SearchRequest{
+				Query: " \t\n\u200b ",
 			},
-			expectedStatus:  http.StatusOK,
-			expectedCount:   0,
-			expectedResults: []SearchResult{},
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "Query cannot be empty",
+			expectedErrorCode:  CodeEmptyQuery,
+		},
+		{
+			name: "QueryTooLong",
+			requestBody: SearchRequest{
+				Query: strings.Repeat("a", maxQueryLength+1),
+			},
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusUnprocessableEntity,
+			expectErrorMessage: "exceeds the maximum",
+			expectedErrorCode:  CodeQueryTooLong,
+		},
+		{
+			name:               "UnknownField",
+			requestBody:        `{"query": "test", "size": 5}`,
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusBadRequest,
+			expectErrorMessage: "unknown field",
+			expectedErrorCode:  CodeInvalidRequest,
+		},
+		{
+			name:               "BodyTooLarge",
+			requestBody:        `{"query": "` + strings.Repeat("a", maxRequestBodyBytes) + `"}`,
+			requestMethod:      http.MethodPost,
+			mockVectorizer:     &mockVectorizer{},
+			mockStore:          &mockStore{},
+			expectedStatus:     http.StatusRequestEntityTooLarge,
+			expectErrorMessage: "Request body exceeds",
+			expectedErrorCode:  CodeRequestTooLarge,
 		},
 	}
 
@@ -177,8 +524,12 @@ func TestHandleSearch(t *testing.T) {
 				reqBody, err = json.Marshal(tc.requestBody)
 				require.NoError(t, err)
 			}
-			req := httptest.NewRequest(tc.requestMethod, "/search", bytes.NewReader(reqBody))
+			if tc.requestURL == "" {
+				tc.requestURL = "/search"
+			}
+			req := httptest.NewRequest(tc.requestMethod, tc.requestURL, bytes.NewReader(reqBody))
 			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(requestIDHeader, "test-request-id")
 			w := httptest.NewRecorder()
 
 			server.handleSearch(w, req)
@@ -194,15 +545,42 @@ func TestHandleSearch(t *testing.T) {
 				for i, expectedResult := range tc.expectedResults {
 					assert.Equal(t, expectedResult.Title, response.Results[i].Title, "Result %d title mismatch", i)
 					assert.Equal(t, expectedResult.URL, response.Results[i].URL, "Result %d URL mismatch", i)
+					assert.Equal(t, expectedResult.Site, response.Results[i].Site, "Result %d site mismatch", i)
 					assert.Equal(t, expectedResult.Score, response.Results[i].Score, "Result %d score mismatch", i)
+					assert.Equal(t, expectedResult.Distance, response.Results[i].Distance, "Result %d distance mismatch", i)
 				}
 				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+				assert.Equal(t, tc.expectedK, tc.mockStore.lastK)
+				assert.Equal(t, tc.expectedOpts, tc.mockStore.lastOpts)
 			}
 
 			if tc.expectErrorMessage != "" {
-				bodyStr := w.Body.String()
-				assert.Contains(t, bodyStr, tc.expectErrorMessage, "Expected error message to contain '%s'", tc.expectErrorMessage)
+				var response ErrorResponse
+				err := json.NewDecoder(w.Body).Decode(&response)
+				require.NoError(t, err, "Failed to decode error response")
+
+				assert.Contains(t, response.Error.Message, tc.expectErrorMessage, "Expected error message to contain '%s'", tc.expectErrorMessage)
+				assert.Equal(t, tc.expectedErrorCode, response.Error.Code)
+				assert.Equal(t, "test-request-id", response.Error.RequestID)
+				assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
 			}
 		})
 	}
 }
+
+func TestSearch(t *testing.T) {
+	server := &Server{
+		store:            &mockStore{searchResults: []store.SearchHit{{Title: "Result 1"}}},
+		vectorizerClient: &mockVectorizer{embedding: []byte("test-embedding")},
+		logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	response, err := server.Search(context.Background(), SearchRequest{Query: "Test  Query"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, response.Count)
+
+	_, err = server.Search(context.Background(), SearchRequest{Query: " "})
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, CodeEmptyQuery, apiErr.Code)
+}
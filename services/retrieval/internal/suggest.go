@@ -0,0 +1,141 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// defaultSuggestLimit is the number of suggestions returned when no limit is requested.
+	defaultSuggestLimit = 5
+	// maxSuggestLimit is the maximum number of suggestions that can be requested.
+	maxSuggestLimit = 20
+	// maxPrefixLength is the maximum number of characters of a suggestion prefix.
+	maxPrefixLength = 100
+)
+
+// Suggestion represents a single query suggestion.
+type Suggestion struct {
+	Title string  `json:"title"`
+	URL   string  `json:"url"`
+	Score float64 `json:"score"`
+}
+
+// SuggestResponse represents the suggest response payload.
+type SuggestResponse struct {
+	Suggestions []Suggestion `json:"suggestions"`
+	Count       int          `json:"count"`
+}
+
+// handleSuggest handles the /suggest endpoint, completing a prefix with the
+// titles of the stored articles.
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		s.writeError(w, r, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	prefix := strings.Join(strings.Fields(r.URL.Query().Get("prefix")), " ")
+	if prefix == "" {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, "Prefix cannot be empty"))
+		return
+	}
+	if utf8.RuneCountInString(prefix) > maxPrefixLength {
+		s.writeError(w, r, newAPIError(CodeQueryTooLong, fmt.Sprintf("Prefix exceeds the maximum of %d characters", maxPrefixLength)))
+		return
+	}
+
+	limit := defaultSuggestLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSuggestLimit {
+			s.writeError(w, r, newAPIError(CodeInvalidRequest, fmt.Sprintf("Limit must be between 1 and %d", maxSuggestLimit)))
+			return
+		}
+		limit = n
+	}
+
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	storeSuggestions, err := articleStore.Suggest(r.Context(), prefix, limit)
+	if err != nil {
+		s.logger.Error("Failed to get suggestions", "error", err, "prefix", prefix, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to get suggestions"))
+		return
+	}
+
+	suggestions := make([]Suggestion, 0, len(storeSuggestions))
+	for _, suggestion := range storeSuggestions {
+		suggestions = append(suggestions, Suggestion{
+			Title: suggestion.Title,
+			URL:   suggestion.Link,
+			Score: suggestion.Score,
+		})
+	}
+
+	s.writeJSON(w, http.StatusOK, SuggestResponse{Suggestions: suggestions, Count: len(suggestions)})
+}
+
+// SuggestHitRequest represents a suggestion hit payload.
+type SuggestHitRequest struct {
+	Title string `json:"title"`
+}
+
+// handleSuggestHit handles the /suggest/hit endpoint, recording that an
+// article title was clicked to rank its suggestion higher. The searches of a
+// title are recorded by recordSearchedTitle.
+func (s *Server) handleSuggestHit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		s.writeError(w, r, newAPIError(CodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	var req SuggestHitRequest
+	if apiErr := decodeRequest(w, r, &req); apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	if req.Title == "" {
+		s.writeError(w, r, newAPIError(CodeInvalidRequest, "Title cannot be empty"))
+		return
+	}
+
+	articleStore, apiErr := s.requestStore(r)
+	if apiErr != nil {
+		s.writeError(w, r, apiErr)
+		return
+	}
+	if err := articleStore.RecordSuggestionHit(r.Context(), req.Title); err != nil {
+		s.logger.Error("Failed to record suggestion hit", "error", err, "title", req.Title, "request_id", requestID(r))
+		s.writeError(w, r, upstreamError(err, CodeStoreUnavailable, "Failed to record suggestion hit"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordSearchedTitle records a hit on the suggestion of the article whose
+// title was searched exactly, on the first page of its results. Failures are
+// only logged.
+func (s *Server) recordSearchedTitle(ctx context.Context, plan *searchPlan, results []SearchResult) {
+	if plan.req.Query == "" || plan.req.Offset > 0 {
+		return
+	}
+	for _, result := range results {
+		if !strings.EqualFold(result.Title, plan.req.Query) {
+			continue
+		}
+		if err := plan.variant.Store.RecordSuggestionHit(ctx, result.ID); err != nil {
+			plan.logger.Warn("Failed to record suggestion hit", "error", err, "title", result.Title)
+		}
+		return
+	}
+}
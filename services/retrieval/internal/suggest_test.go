@@ -0,0 +1,186 @@
+package retrieval
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestHandleSuggest(t *testing.T) {
+	testCases := []struct {
+		name                string
+		url                 string
+		mockStore           *mockStore
+		expectedStatus      int
+		expectedErrorCode   ErrorCode
+		expectedPrefix      string
+		expectedLimit       int
+		expectedSuggestions []Suggestion
+	}{
+		{
+			name: "Success",
+			url:  "/suggest?prefix=%20%20Macron%20%20an&limit=2",
+			mockStore: &mockStore{
+				suggestions: []store.Suggestion{
+					{Title: "Macron annonce", Link: "http://vsd.fr/1", Score: 3},
+					{Title: "Macron anniversaire", Link: "http://public.fr/2", Score: 1},
+				},
+			},
+			expectedStatus: http.StatusOK,
+			expectedPrefix: "Macron an",
+			expectedLimit:  2,
+			expectedSuggestions: []Suggestion{
+				{Title: "Macron annonce", URL: "http://vsd.fr/1", Score: 3},
+				{Title: "Macron anniversaire", URL: "http://public.fr/2", Score: 1},
+			},
+		},
+		{
+			name:                "DefaultLimit",
+			url:                 "/suggest?prefix=mac",
+			mockStore:           &mockStore{},
+			expectedStatus:      http.StatusOK,
+			expectedPrefix:      "mac",
+			expectedLimit:       defaultSuggestLimit,
+			expectedSuggestions: []Suggestion{},
+		},
+		{
+			name:              "EmptyPrefix",
+			url:               "/suggest?prefix=%20",
+			mockStore:         &mockStore{},
+			expectedStatus:    http.StatusBadRequest,
+			expectedErrorCode: CodeInvalidRequest,
+		},
+		{
+			name:              "PrefixTooLong",
+			url:               "/suggest?prefix=" + strings.Repeat("a", maxPrefixLength+1),
+			mockStore:         &mockStore{},
+			expectedStatus:    http.StatusUnprocessableEntity,
+			expectedErrorCode: CodeQueryTooLong,
+		},
+		{
+			name:              "InvalidLimit",
+			url:               "/suggest?prefix=mac&limit=100",
+			mockStore:         &mockStore{},
+			expectedStatus:    http.StatusBadRequest,
+			expectedErrorCode: CodeInvalidRequest,
+		},
+		{
+			name:              "StoreError",
+			url:               "/suggest?prefix=mac",
+			mockStore:         &mockStore{suggestErr: errors.New("connection refused")},
+			expectedStatus:    http.StatusServiceUnavailable,
+			expectedErrorCode: CodeStoreUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:  tc.mockStore,
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			w := httptest.NewRecorder()
+			server.handleSuggest(w, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			require.Equal(t, tc.expectedStatus, w.Code)
+
+			if tc.expectedStatus != http.StatusOK {
+				var response ErrorResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+				assert.Equal(t, tc.expectedErrorCode, response.Error.Code)
+				return
+			}
+
+			var response SuggestResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, tc.expectedPrefix, tc.mockStore.lastPrefix)
+			assert.Equal(t, tc.expectedLimit, tc.mockStore.lastK)
+			assert.Equal(t, tc.expectedSuggestions, response.Suggestions)
+			assert.Equal(t, len(tc.expectedSuggestions), response.Count)
+		})
+	}
+}
+
+func TestHandleSuggestHit(t *testing.T) {
+	testCases := []struct {
+		name           string
+		body           string
+		mockStore      *mockStore
+		expectedStatus int
+		expectedHits   []string
+	}{
+		{
+			name:           "Success",
+			body:           `{"title": "Macron annonce"}`,
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusNoContent,
+			expectedHits:   []string{"Macron annonce"},
+		},
+		{
+			name:           "EmptyTitle",
+			body:           `{"title": ""}`,
+			mockStore:      &mockStore{},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "StoreError",
+			body:           `{"title": "Macron annonce"}`,
+			mockStore:      &mockStore{suggestErr: errors.New("connection refused")},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &Server{
+				store:  tc.mockStore,
+				logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			w := httptest.NewRecorder()
+			server.handleSuggestHit(w, httptest.NewRequest(http.MethodPost, "/suggest/hit", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, tc.expectedHits, tc.mockStore.hits)
+		})
+	}
+}
+
+func TestSearchRecordsSearchedTitle(t *testing.T) {
+	testCases := []struct {
+		name         string
+		url          string
+		expectedHits []string
+	}{
+		{name: "ExactTitle", url: "/search?q=macron+ANNONCE", expectedHits: []string{"Macron annonce"}},
+		{name: "OtherQuery", url: "/search?q=macron"},
+		{name: "NextPage", url: "/search?q=macron+annonce&offset=1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockStore := &mockStore{searchResults: []store.SearchHit{
+				{ID: "Macron anniversaire", Title: "Macron anniversaire"},
+				{ID: "Macron annonce", Title: "Macron annonce"},
+			}}
+			server := &Server{
+				store:            mockStore,
+				vectorizerClient: &mockVectorizer{embedding: []byte("embedding")},
+				logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			w := httptest.NewRecorder()
+			server.handleSearch(w, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tc.expectedHits, mockStore.hits)
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package retrieval
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the embedded search UI.
+func uiHandler() http.Handler {
+	root, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		// The embedded directory is known at compile time.
+		panic(err)
+	}
+	return http.FileServerFS(root)
+}
@@ -0,0 +1,173 @@
+// Single page search UI, backed by the /search endpoint.
+(function () {
+  "use strict";
+
+  // Number of results loaded per page, and maximum rank reachable through
+  // pagination (the server's maximum limit).
+  const pageSize = 20;
+  const maxResults = 100;
+  // Delay before fetching suggestions, while the user is typing.
+  const suggestDelayMs = 150;
+
+  const form = document.getElementById("search-form");
+  const queryInput = document.getElementById("query");
+  const siteSelect = document.getElementById("site");
+  const status = document.getElementById("status");
+  const results = document.getElementById("results");
+  const sentinel = document.getElementById("sentinel");
+  const cardTemplate = document.getElementById("result-card");
+  const suggestionList = document.getElementById("suggestions");
+
+  // State of the current search.
+  let search = null;
+
+  function setStatus(text, isError) {
+    status.textContent = text;
+    status.classList.toggle("error", Boolean(isError));
+  }
+
+  // recordHit ranks higher the suggestion of a title clicked or searched.
+  function recordHit(title) {
+    navigator.sendBeacon("/suggest/hit", new Blob([JSON.stringify({ title: title })], { type: "application/json" }));
+  }
+
+  let suggestTimer = null;
+  function suggest(prefix) {
+    clearTimeout(suggestTimer);
+    if (!prefix.trim()) {
+      suggestionList.replaceChildren();
+      return;
+    }
+    suggestTimer = setTimeout(async function () {
+      try {
+        const response = await fetch("/suggest?" + new URLSearchParams({ prefix: prefix }));
+        if (!response.ok) {
+          return;
+        }
+        const payload = await response.json();
+        suggestionList.replaceChildren(...payload.suggestions.map(function (suggestion) {
+          const option = document.createElement("option");
+          option.value = suggestion.title;
+          return option;
+        }));
+      } catch (err) {
+        // Suggestions are best effort.
+      }
+    }, suggestDelayMs);
+  }
+
+  // recordClick logs the click on a result of a search for analytics.
+  function recordClick(searchId, result, rank) {
+    const feedback = { search_id: searchId, type: "click", result_id: result.id, rank: rank };
+    navigator.sendBeacon("/feedback", new Blob([JSON.stringify(feedback)], { type: "application/json" }));
+  }
+
+  function renderResult(result, searchId, rank) {
+    const card = cardTemplate.content.cloneNode(true);
+    const title = card.querySelector(".title");
+    title.textContent = result.title;
+    title.href = result.url;
+    title.addEventListener("click", function () {
+      recordHit(result.title);
+      recordClick(searchId, result, rank);
+    });
+    card.querySelector(".site").textContent = result.site || "";
+    const date = card.querySelector(".date");
+    if (result.published_at) {
+      date.dateTime = result.published_at;
+      date.textContent = new Date(result.published_at).toLocaleDateString("fr-FR");
+    }
+    card.querySelector(".score").textContent = "score " + result.score.toFixed(3);
+    results.appendChild(card);
+  }
+
+  async function loadMore() {
+    if (!search || search.loading || search.done) {
+      return;
+    }
+    search.loading = true;
+    const current = search;
+
+    try {
+      const response = await fetch("/search", {
+        method: "POST",
+        headers: { "Content-Type": "application/json", "Accept": "application/json" },
+        body: JSON.stringify({
+          query: current.query,
+          site: current.site || undefined,
+          limit: Math.min(pageSize, maxResults - current.offset),
+          offset: current.offset,
+        }),
+      });
+      const payload = await response.json();
+      if (current !== search) {
+        return; // A new search started meanwhile.
+      }
+      if (!response.ok) {
+        setStatus(payload.error ? payload.error.message : "La recherche a échoué", true);
+        current.done = true;
+        return;
+      }
+
+      payload.results.forEach(function (result, i) {
+        renderResult(result, payload.search_id, current.offset + i + 1);
+      });
+      current.offset += payload.count;
+      current.done = payload.count < pageSize || current.offset >= maxResults;
+      setStatus(current.offset === 0 ? "Aucun résultat" : current.offset + " résultats");
+    } catch (err) {
+      setStatus("La recherche a échoué : " + err.message, true);
+      current.done = true;
+    } finally {
+      current.loading = false;
+    }
+  }
+
+  function startSearch(query, site) {
+    search = { query: query, site: site, offset: 0, loading: false, done: false };
+    results.replaceChildren();
+    setStatus("Recherche…");
+
+    const params = new URLSearchParams({ q: query });
+    if (site) {
+      params.set("site", site);
+    }
+    history.replaceState(null, "", "?" + params.toString());
+    loadMore();
+  }
+
+  form.addEventListener("submit", function (event) {
+    event.preventDefault();
+    const query = queryInput.value.trim();
+    if (query) {
+      const picked = Array.from(suggestionList.options).some(function (option) { return option.value === query; });
+      if (picked) {
+        recordHit(query);
+      }
+      startSearch(query, siteSelect.value);
+    }
+  });
+  queryInput.addEventListener("input", function () {
+    suggest(queryInput.value);
+  });
+  siteSelect.addEventListener("change", function () {
+    if (search) {
+      startSearch(search.query, siteSelect.value);
+    }
+  });
+
+  // Infinite scroll: load the next page when the end of the list is visible.
+  new IntersectionObserver(function (entries) {
+    if (entries.some(function (entry) { return entry.isIntersecting; })) {
+      loadMore();
+    }
+  }).observe(sentinel);
+
+  // Restore the search from the URL, so searches can be bookmarked.
+  const initial = new URLSearchParams(location.search);
+  if (initial.get("q")) {
+    queryInput.value = initial.get("q");
+    siteSelect.value = initial.get("site") || "";
+    startSearch(queryInput.value, siteSelect.value);
+  }
+})();
@@ -0,0 +1,34 @@
+package retrieval
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUIHandler(t *testing.T) {
+	testCases := []struct {
+		path                string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{path: "/", expectedStatus: http.StatusOK, expectedContentType: "text/html; charset=utf-8"},
+		{path: "/app.js", expectedStatus: http.StatusOK, expectedContentType: "text/javascript; charset=utf-8"},
+		{path: "/style.css", expectedStatus: http.StatusOK, expectedContentType: "text/css; charset=utf-8"},
+		{path: "/missing.js", expectedStatus: http.StatusNotFound},
+	}
+
+	handler := uiHandler()
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			if tc.expectedContentType != "" {
+				assert.Equal(t, tc.expectedContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"time"
+)
+
+// controlVariant is the name of the variant of the default vectorizer and store.
+const controlVariant = "control"
+
+const (
+	// sessionCookie identifies the browser sessions, for their searches to be
+	// routed to the same variant.
+	sessionCookie = "gs_session"
+	// sessionCookieMaxAge is the lifetime of the session cookie.
+	sessionCookieMaxAge = 30 * 24 * time.Hour
+)
+
+// Variant is an alternative vectorizer and store pair, searched by a share of
+// the queries to compare its relevance with the control variant.
+type Variant struct {
+	Name       string
+	Vectorizer Vectorizer
+	Store      Store
+	// Percent is the percentage of the queries routed to the variant, when
+	// they do not request a variant.
+	Percent int
+}
+
+// validateVariants checks that the variants have unique names, and that their
+// percentages fit in 100.
+func validateVariants(variants []Variant) error {
+	names := map[string]bool{controlVariant: true}
+	total := 0
+	for _, variant := range variants {
+		if variant.Name == "" || names[variant.Name] {
+			return fmt.Errorf("invalid or duplicate variant name %q", variant.Name)
+		}
+		names[variant.Name] = true
+		if variant.Percent < 0 {
+			return fmt.Errorf("invalid percentage %d of variant %s", variant.Percent, variant.Name)
+		}
+		total += variant.Percent
+	}
+	if total > 100 {
+		return fmt.Errorf("variants percentages add up to %d, above 100", total)
+	}
+	return nil
+}
+
+// pickVariant returns the variant requested by name, or draws one according
+// to the variants percentages when no name is given. The draw is a hash of the
+// routing key, so that the searches of a key are routed to the same variant.
+// The control variant searches the live index version with the vectorizer of
+// its model.
+func (s *Server) pickVariant(ctx context.Context, name, routingKey string) (Variant, *APIError) {
+	control := s.liveVariant(ctx, "", s.store)
+	if name != "" {
+		if name == controlVariant {
+			return control, nil
+		}
+		for _, variant := range s.opts.Variants {
+			if variant.Name == name {
+				return variant, nil
+			}
+		}
+		return Variant{}, newAPIError(CodeInvalidRequest, fmt.Sprintf("Unknown variant %q", name))
+	}
+
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(routingKey))
+	roll := int(hash.Sum32() % 100)
+	for _, variant := range s.opts.Variants {
+		if roll < variant.Percent {
+			return variant, nil
+		}
+		roll -= variant.Percent
+	}
+	return control, nil
+}
+
+// variantSession returns the identifier the variant of the searches of a client
+// is drawn from: its API key, or its session cookie. A session cookie is given
+// to the browsers without one when create is set. It is empty when no variant
+// is configured, and for the unidentified clients.
+func (s *Server) variantSession(w http.ResponseWriter, r *http.Request, create bool) string {
+	if len(s.opts.Variants) == 0 {
+		return ""
+	}
+	if key := requestAPIKey(r); key != "" {
+		return "key:" + key
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil && cookie.Value != "" {
+		return "session:" + cookie.Value
+	}
+	if !create {
+		return ""
+	}
+	session := newRequestID()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session,
+		Path:     "/",
+		MaxAge:   int(sessionCookieMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "session:" + session
+}
+
+// withSessionCookie gives a session cookie to the browsers loading the UI,
+// before their first search.
+func (s *Server) withSessionCookie(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.variantSession(w, r, true)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,139 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+func TestValidateVariants(t *testing.T) {
+	testCases := []struct {
+		name        string
+		variants    []Variant
+		expectError string
+	}{
+		{name: "NoVariant"},
+		{name: "Valid", variants: []Variant{{Name: "e5", Percent: 40}, {Name: "mpnet", Percent: 60}}},
+		{name: "ControlName", variants: []Variant{{Name: controlVariant}}, expectError: "duplicate variant name"},
+		{name: "DuplicateName", variants: []Variant{{Name: "e5"}, {Name: "e5"}}, expectError: "duplicate variant name"},
+		{name: "NegativePercent", variants: []Variant{{Name: "e5", Percent: -1}}, expectError: "invalid percentage"},
+		{name: "PercentAbove100", variants: []Variant{{Name: "e5", Percent: 60}, {Name: "mpnet", Percent: 50}}, expectError: "add up to 110"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateVariants(tc.variants)
+			if tc.expectError != "" {
+				assert.ErrorContains(t, err, tc.expectError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSearchVariants(t *testing.T) {
+	testCases := []struct {
+		name            string
+		body            string
+		percent         int
+		expectedStatus  int
+		expectedVariant string
+	}{
+		{name: "DrawnControl", body: `{"query": "test"}`, percent: 0, expectedStatus: http.StatusOK, expectedVariant: controlVariant},
+		{name: "DrawnVariant", body: `{"query": "test"}`, percent: 100, expectedStatus: http.StatusOK, expectedVariant: "e5"},
+		{name: "RequestedVariant", body: `{"query": "test", "variant": "e5"}`, percent: 0, expectedStatus: http.StatusOK, expectedVariant: "e5"},
+		{name: "RequestedControl", body: `{"query": "test", "variant": "control"}`, percent: 100, expectedStatus: http.StatusOK, expectedVariant: controlVariant},
+		{name: "UnknownVariant", body: `{"query": "test", "variant": "unknown"}`, expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			controlStore := &mockStore{searchResults: []store.SearchHit{{Title: "Control result"}}}
+			variantStore := &mockStore{searchResults: []store.SearchHit{{Title: "Variant result"}}}
+			server, err := New("", controlStore, &mockVectorizer{embedding: []byte("control")}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+				Variants: []Variant{{
+					Name:       "e5",
+					Vectorizer: &mockVectorizer{embedding: []byte("variant")},
+					Store:      variantStore,
+					Percent:    tc.percent,
+				}},
+			})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/search", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			server.routes().ServeHTTP(w, req)
+
+			require.Equal(t, tc.expectedStatus, w.Code, w.Body.String())
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+			var response SearchResponse
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+			assert.Equal(t, tc.expectedVariant, response.Variant)
+			assert.Equal(t, tc.expectedVariant, w.Header().Get("X-Search-Variant"))
+			require.Len(t, response.Results, 1)
+			if tc.expectedVariant == controlVariant {
+				assert.Equal(t, "Control result", response.Results[0].Title)
+				assert.Zero(t, variantStore.lastK)
+			} else {
+				assert.Equal(t, "Variant result", response.Results[0].Title)
+				assert.Zero(t, controlStore.lastK)
+			}
+		})
+	}
+}
+
+func TestSearchVariantsSticky(t *testing.T) {
+	server, err := New("", &mockStore{}, &mockVectorizer{embedding: []byte("control")}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+		Variants: []Variant{{Name: "e5", Vectorizer: &mockVectorizer{embedding: []byte("variant")}, Store: &mockStore{}, Percent: 50}},
+		APIKeys:  map[string][]string{"key": nil},
+	})
+	require.NoError(t, err)
+	handler := server.routes()
+
+	search := func(target string, setup func(*http.Request)) string {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		setup(req)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w.Header().Get("X-Search-Variant")
+	}
+
+	// The browsers loading the UI are given a session cookie.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, sessionCookie, cookies[0].Name)
+
+	// The pages and queries of a session, an API key or a query are routed to
+	// the same variant, and the sessions are split between the variants.
+	drawn := make(map[string]bool)
+	for i := range 20 {
+		withCookie := func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: sessionCookie, Value: fmt.Sprintf("session-%d", i)})
+		}
+		variant := search("/search?q=first", withCookie)
+		assert.Equal(t, variant, search("/search?q=first&offset=10", withCookie))
+		assert.Equal(t, variant, search("/search?q=second", withCookie))
+		drawn[variant] = true
+	}
+	assert.Equal(t, map[string]bool{controlVariant: true, "e5": true}, drawn)
+
+	withKey := func(req *http.Request) { req.Header.Set("Authorization", "Bearer key") }
+	assert.Equal(t, search("/search?q=first", withKey), search("/search?q=second&offset=10", withKey))
+	anonymous := func(*http.Request) {}
+	assert.Equal(t, search("/search?q=first", anonymous), search("/search?q=first&offset=10", anonymous))
+}
@@ -0,0 +1,54 @@
+package retrieval
+
+import (
+	"context"
+	"sync"
+)
+
+// IndexVersions resolves the live index versions of the collections, along
+// with the vectorizers of their models, so that the queries are embedded with
+// the model of the version they search.
+type IndexVersions interface {
+	// ResolveVersion returns a store operating on the live index version of a
+	// collection, the default one when unnamed, and the address of the
+	// vectorizer of its model, empty when none is recorded.
+	ResolveVersion(ctx context.Context, collection string) (Store, string)
+	// NewVectorizer returns the vectorizer of an address.
+	NewVectorizer(addr string) Vectorizer
+}
+
+// versionVectorizers holds the vectorizers of the index versions by address,
+// each with its own circuit.
+type versionVectorizers struct {
+	mu          sync.Mutex
+	vectorizers map[string]Vectorizer
+}
+
+// liveVariant returns the control variant of a collection: its live index
+// version and the vectorizer of its model, or the collection store and the
+// server vectorizer when the versions are not resolved.
+func (s *Server) liveVariant(ctx context.Context, collection string, collectionStore Store) Variant {
+	variant := Variant{Name: controlVariant, Vectorizer: s.vectorizerClient, Store: collectionStore}
+	if s.opts.IndexVersions == nil {
+		return variant
+	}
+	var addr string
+	variant.Store, addr = s.opts.IndexVersions.ResolveVersion(ctx, collection)
+	if addr != "" {
+		variant.Vectorizer = s.versionVectorizer(addr)
+	}
+	return variant
+}
+
+// versionVectorizer returns the vectorizer of an address, created on its
+// first use.
+func (s *Server) versionVectorizer(addr string) Vectorizer {
+	s.vectorizers.mu.Lock()
+	defer s.vectorizers.mu.Unlock()
+	vectorizer, ok := s.vectorizers.vectorizers[addr]
+	if !ok {
+		vectorizer = withCircuitBreaker(s.opts.IndexVersions.NewVectorizer(addr), s.opts.CircuitBreaker, s.logger.With("variant", controlVariant, "vectorizer", addr))
+		s.vectorizers.vectorizers[addr] = vectorizer
+	}
+	return vectorizer
+}
@@ -0,0 +1,83 @@
+package retrieval
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/turanic/gs_search/pkg/store"
+)
+
+// mockIndexVersions implements the IndexVersions interface for testing.
+type mockIndexVersions struct {
+	stores      map[string]*mockStore
+	addr        string
+	vectorizers map[string]*mockVectorizer
+}
+
+func (m *mockIndexVersions) ResolveVersion(ctx context.Context, collection string) (Store, string) {
+	return m.stores[collection], m.addr
+}
+
+func (m *mockIndexVersions) NewVectorizer(addr string) Vectorizer {
+	return m.vectorizers[addr]
+}
+
+func TestSearchLiveVersion(t *testing.T) {
+	versionStore := &mockStore{searchResults: []store.SearchHit{{ID: "v2", Title: "Version 2"}}}
+	versions := &mockIndexVersions{
+		stores:      map[string]*mockStore{"": versionStore, "docs": versionStore},
+		vectorizers: map[string]*mockVectorizer{"http://vectorizer-v2:8080": {embedding: []byte("embedding-v2")}},
+	}
+	server, err := New("0", &mockStore{}, &mockVectorizer{embedding: []byte("embedding-v1")}, slog.New(slog.NewTextHandler(io.Discard, nil)), Options{
+		AdminToken:    "secret",
+		Collections:   map[string]Store{"docs": &mockStore{}},
+		APIKeys:       map[string][]string{"key": {"docs"}},
+		IndexVersions: versions,
+	})
+	require.NoError(t, err)
+	handler := server.routes()
+
+	search := func(target string) SearchResponse {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer key")
+		handler.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response SearchResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return response
+	}
+
+	// The server vectorizer is used until a vectorizer is recorded with the
+	// live version.
+	response := search("/search?q=test+query")
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "v2", response.Results[0].ID)
+	assert.Equal(t, []byte("embedding-v1"), versionStore.lastEmbedding)
+
+	versions.addr = "http://vectorizer-v2:8080"
+	response = search("/search?q=test+query")
+	assert.Equal(t, "v2", response.Results[0].ID)
+	assert.Equal(t, []byte("embedding-v2"), versionStore.lastEmbedding)
+
+	versionStore.lastEmbedding = nil
+	search("/search?q=test+query&collection=docs")
+	assert.Equal(t, []byte("embedding-v2"), versionStore.lastEmbedding)
+
+	// The upserted articles are embedded and stored with the live version.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/articles", strings.NewReader(`{"title": "Title", "url": "https://example.com/a"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, versionStore.storedArticles, 1)
+	assert.Equal(t, []byte("embedding-v2"), versionStore.storedArticles[0].Embedding)
+}
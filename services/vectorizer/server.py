@@ -1,6 +1,6 @@
 from fastapi import FastAPI, HTTPException
 from pydantic import BaseModel
-from sentence_transformers import SentenceTransformer
+from sentence_transformers import CrossEncoder, SentenceTransformer
 from typing import List
 import base64
 import logging
@@ -22,6 +22,14 @@ logger.info(f"Loading model: {MODEL_NAME}")
 model = SentenceTransformer(MODEL_NAME)
 logger.info(f"Model loaded. Embedding dimension: {model.get_sentence_embedding_dimension()}")
 
+# Load the optional reranking model at startup.
+RERANK_MODEL_NAME = os.getenv("RERANK_MODEL_NAME")
+reranker = None
+if RERANK_MODEL_NAME:
+    logger.info(f"Loading reranking model: {RERANK_MODEL_NAME}")
+    reranker = CrossEncoder(RERANK_MODEL_NAME)
+    logger.info("Reranking model loaded.")
+
 
 class EmbedRequest(BaseModel):
     texts: List[str]
@@ -69,6 +77,39 @@ def embed_text(request: EmbedRequest):
         raise HTTPException(status_code=500, detail=f"Failed to generate embeddings: {str(e)}")
 
 
+class RerankRequest(BaseModel):
+    query: str
+    documents: List[str]
+
+
+class RerankResponse(BaseModel):
+    scores: List[float]
+
+
+@app.post("/rerank", response_model=RerankResponse)
+def rerank(request: RerankRequest):
+    """
+    Score the relevance of each document to the query with the cross-encoder.
+    """
+    if reranker is None:
+        raise HTTPException(status_code=404, detail="No reranking model loaded")
+    if not request.query or not request.query.strip():
+        raise HTTPException(status_code=400, detail="Query cannot be empty")
+    if not request.documents:
+        raise HTTPException(status_code=400, detail="Documents array cannot be empty")
+
+    try:
+        scores = reranker.predict(
+            [(request.query, document) for document in request.documents],
+            convert_to_numpy=True,
+            show_progress_bar=False,
+        )
+        return RerankResponse(scores=[float(score) for score in scores])
+    except Exception as e:
+        logger.error(f"Error reranking documents: {e}")
+        raise HTTPException(status_code=500, detail=f"Failed to rerank documents: {str(e)}")
+
+
 @app.get("/health")
 def health_check():
     """
@@ -77,7 +118,8 @@ def health_check():
     return {
         "status": "ok",
         "model": MODEL_NAME,
-        "dimension": model.get_sentence_embedding_dimension()
+        "dimension": model.get_sentence_embedding_dimension(),
+        "rerank_model": RERANK_MODEL_NAME,
     }
 
 
@@ -92,6 +134,7 @@ async def root():
         "dimension": model.get_sentence_embedding_dimension(),
         "endpoints": {
             "embed": "POST /embed - Generate embeddings",
+            "rerank": "POST /rerank - Score documents against a query",
             "health": "GET /health - Health check"
         }
     }